@@ -0,0 +1,149 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultTokenRefreshBefore is how long before their expiry cached tokens are refreshed
+const DefaultTokenRefreshBefore = time.Minute
+
+// Token is an authentication token
+type Token struct {
+	// Value is sent in the authorization metadata of every call
+	Value string
+	// Expiry is when the token expires (zero = never)
+	Expiry time.Time
+}
+
+// TokenSource supplies the authentication tokens of the client.
+// The client caches tokens until shortly before they expire, so Token is only called
+// to get a new token.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc is a function that implements TokenSource
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token calls f
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// staticTokenSource is a TokenSource returning a token that never expires
+type staticTokenSource struct {
+	token *Token
+}
+
+// StaticTokenSource returns a TokenSource that always returns the token
+func StaticTokenSource(token string) TokenSource {
+	return &staticTokenSource{token: &Token{Value: token}}
+}
+
+// Token returns the static token
+func (s *staticTokenSource) Token(context.Context) (*Token, error) {
+	return s.token, nil
+}
+
+// CachingTokenSource caches the tokens of another source and gets a new one when the
+// cached token is about to expire or was invalidated. It is safe for concurrent use.
+type CachingTokenSource struct {
+	source        TokenSource
+	refreshBefore time.Duration
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewCachingTokenSource creates a CachingTokenSource that refreshes tokens refreshBefore their expiry
+func NewCachingTokenSource(source TokenSource, refreshBefore time.Duration) *CachingTokenSource {
+	return &CachingTokenSource{
+		source:        source,
+		refreshBefore: refreshBefore,
+	}
+}
+
+// Token returns the cached token, getting a new one from the source when needed
+func (s *CachingTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && (s.token.Expiry.IsZero() || time.Until(s.token.Expiry) > s.refreshBefore) {
+		return s.token, nil
+	}
+	token, err := s.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.Value == "" {
+		return nil, errors.New("token source returned an empty token")
+	}
+	s.token = token
+	return token, nil
+}
+
+// Invalidate drops the cached token, so the next call gets a new one
+func (s *CachingTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+}
+
+// tokenSource returns the token source of the client: the configured source wrapped in a
+// cache, or the static token
+func (c *Client) tokenSource() TokenSource {
+	c.tokensOnce.Do(func() {
+		switch source := c.config.TokenSource.(type) {
+		case nil:
+			c.tokens = StaticTokenSource(c.config.Token)
+		case *CachingTokenSource:
+			c.tokens = source
+		default:
+			c.tokens = NewCachingTokenSource(source, DefaultTokenRefreshBefore)
+		}
+	})
+	return c.tokens
+}
+
+// refreshToken drops the cached token after an Unauthenticated error and reports whether
+// the call should be retried with a new token
+func (c *Client) refreshToken(ctx context.Context, err error) bool {
+	if status.Code(err) != codes.Unauthenticated {
+		return false
+	}
+	source, ok := c.tokenSource().(*CachingTokenSource)
+	if !ok {
+		return false
+	}
+	c.log(ctx).WithError(err).Warn("Call unauthenticated, refreshing token")
+	source.Invalidate()
+	return true
+}
+
+// tokenCredentials sends the token of the client in the authorization metadata of every call
+type tokenCredentials struct {
+	client *Client
+}
+
+// GetRequestMetadata returns the authorization metadata
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := t.client.tokenSource().Token(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to get token: %v", err)
+	}
+	return map[string]string{"authorization": token.Value}, nil
+}
+
+// RequireTransportSecurity reports false, tokens are also sent when TLS is disabled
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+var _ credentials.PerRPCCredentials = tokenCredentials{}
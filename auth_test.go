@@ -0,0 +1,189 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// countingTokenSource issues the tokens t1, t2, ... with the lifetime
+type countingTokenSource struct {
+	mu       sync.Mutex
+	issued   int
+	lifetime time.Duration
+}
+
+func (s *countingTokenSource) Token(context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.issued++
+	return &Token{Value: fmt.Sprintf("t%d", s.issued), Expiry: time.Now().Add(s.lifetime)}, nil
+}
+
+// authToken returns the token in the authorization metadata of an incoming call
+func authToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tokens := md.Get("authorization"); len(tokens) > 0 {
+		return tokens[0]
+	}
+	return ""
+}
+
+func TestCachingTokenSource(t *testing.T) {
+	ctx := context.Background()
+	source := &countingTokenSource{lifetime: time.Hour}
+	cache := NewCachingTokenSource(source, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if token, _ := cache.Token(ctx); token.Value != "t1" {
+			t.Fatalf("Expected the cached token t1, got %s", token.Value)
+		}
+	}
+	cache.Invalidate()
+	if token, _ := cache.Token(ctx); token.Value != "t2" {
+		t.Errorf("Expected a new token after Invalidate, got %s", token.Value)
+	}
+
+	// Tokens expiring within refreshBefore are refreshed
+	expiring := NewCachingTokenSource(&countingTokenSource{lifetime: 30 * time.Second}, time.Minute)
+	expiring.Token(ctx)
+	if token, _ := expiring.Token(ctx); token.Value != "t2" {
+		t.Errorf("Expected an expiring token to be refreshed, got %s", token.Value)
+	}
+
+	failing := NewCachingTokenSource(TokenSourceFunc(func(context.Context) (*Token, error) {
+		return &Token{}, nil
+	}), time.Minute)
+	if _, err := failing.Token(ctx); err == nil {
+		t.Error("Expected error for an empty token")
+	}
+}
+
+func TestTokenSource_RefreshOnUnauthenticated(t *testing.T) {
+	var seen []string
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			token := authToken(ctx)
+			seen = append(seen, token)
+			if token != "t2" {
+				return nil, status.Error(codes.Unauthenticated, "token expired")
+			}
+			return &mqv1.CountMessagesResponse{MessagesCount: 7}, nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.TokenSource = &countingTokenSource{lifetime: time.Hour}
+	client.config.RetryPolicy = nil
+
+	count, err := client.CountMessages(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("CountMessages failed: %v", err)
+	}
+	if count != 7 {
+		t.Errorf("Expected 7 messages, got %d", count)
+	}
+	if len(seen) != 2 || seen[0] != "t1" || seen[1] != "t2" {
+		t.Errorf("Expected calls with t1 then t2, got %v", seen)
+	}
+
+	// The token is refreshed only once per call
+	seen = nil
+	srv.countFunc = func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+		seen = append(seen, authToken(ctx))
+		return nil, status.Error(codes.Unauthenticated, "revoked")
+	}
+	_, err = client.CountMessages(context.Background(), "orders")
+	if decodeErrCode(err) != ErrCodeAuth {
+		t.Errorf("Expected an auth error, got %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "t2" || seen[1] != "t3" {
+		t.Errorf("Expected calls with the cached t2 then t3, got %v", seen)
+	}
+}
+
+func TestStaticToken_NotRefreshed(t *testing.T) {
+	calls := 0
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			calls++
+			if authToken(ctx) != "test-token" {
+				t.Errorf("Expected the static token, got %q", authToken(ctx))
+			}
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		},
+	}
+	client := newTestClient(t, srv)
+
+	if _, err := client.CountMessages(context.Background(), "orders"); decodeErrCode(err) != ErrCodeAuth {
+		t.Errorf("Expected an auth error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected a static token not to be retried, got %d calls", calls)
+	}
+}
+
+func TestTokenSource_Error(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			return &mqv1.CountMessagesResponse{}, nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.TokenSource = TokenSourceFunc(func(context.Context) (*Token, error) {
+		return nil, errors.New("secret manager unavailable")
+	})
+
+	if _, err := client.CountMessages(context.Background(), "orders"); decodeErrCode(err) != ErrCodeAuth {
+		t.Errorf("Expected an auth error, got %v", err)
+	}
+}
+
+func TestSub_RefreshTokenMidStream(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			token := authToken(stream.Context())
+			stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: token})
+			if token == "t1" {
+				return status.Error(codes.Unauthenticated, "token expired")
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.TokenSource = &countingTokenSource{lifetime: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgChan, errChan, err := client.Sub(ctx, NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	for _, expected := range []string{"t1", "t2"} {
+		select {
+		case msg := <-msgChan:
+			if msg == nil || msg.UUID != expected {
+				t.Fatalf("Expected a message sent with %s, got %+v", expected, msg)
+			}
+		case err := <-errChan:
+			t.Fatalf("Unexpected error: %v", err)
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for messages")
+		}
+	}
+}
+
+func TestConfig_ValidateTokenSource(t *testing.T) {
+	if err := NewConfig(WithTokenSource(StaticTokenSource("t"))).Validate(); err != nil {
+		t.Errorf("Expected a token source to replace the token, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package togomq
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Default backoff values
+const (
+	DefaultBackoffInitialDelay = 100 * time.Millisecond
+	DefaultBackoffMaxDelay     = 30 * time.Second
+	DefaultBackoffMultiplier   = 2.0
+	DefaultBackoffJitter       = 0.2
+)
+
+// Backoff describes an exponential backoff curve with jitter.
+// Zero values are replaced by the defaults when computing delays.
+type Backoff struct {
+	// InitialDelay is the delay before the first retry (default: 100ms)
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between two attempts (default: 30s)
+	MaxDelay time.Duration
+	// Multiplier is applied to the delay after every attempt (default: 2)
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1 (default: 0.2)
+	Jitter float64
+}
+
+// DefaultBackoff returns a Backoff with default values
+func DefaultBackoff() Backoff {
+	return Backoff{
+		InitialDelay: DefaultBackoffInitialDelay,
+		MaxDelay:     DefaultBackoffMaxDelay,
+		Multiplier:   DefaultBackoffMultiplier,
+		Jitter:       DefaultBackoffJitter,
+	}
+}
+
+// Delay returns the delay to wait before the given attempt (starting at 1)
+func (b Backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	initial := b.InitialDelay
+	if initial <= 0 {
+		initial = DefaultBackoffInitialDelay
+	}
+	maxDelay := b.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultBackoffMaxDelay
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = DefaultBackoffMultiplier
+	}
+	jitter := b.Jitter
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	delay := math.Min(float64(initial)*math.Pow(multiplier, float64(attempt-1)), float64(maxDelay))
+
+	// Spread the delay uniformly over [delay*(1-jitter), delay*(1+jitter)], without exceeding the cap
+	if jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(math.Min(delay, float64(maxDelay)))
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package togomq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, want := range expected {
+		if got := b.Delay(i + 1); got != want {
+			t.Errorf("Delay(%d) = %v, expected %v", i+1, got, want)
+		}
+	}
+}
+
+func TestBackoffDelay_Jitter(t *testing.T) {
+	b := Backoff{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		Jitter:       0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		d := b.Delay(1)
+		if d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("Delay with jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestBackoffDelay_JitterCapped(t *testing.T) {
+	b := Backoff{
+		InitialDelay: time.Second,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		Jitter:       0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(3); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("Delay with jitter above the max delay: %v", d)
+		}
+	}
+}
+
+func TestBackoffDelay_Defaults(t *testing.T) {
+	var b Backoff
+	if got := b.Delay(1); got != DefaultBackoffInitialDelay {
+		t.Errorf("Expected default initial delay %v, got %v", DefaultBackoffInitialDelay, got)
+	}
+	if got := b.Delay(100); got != DefaultBackoffMaxDelay {
+		t.Errorf("Expected default max delay %v, got %v", DefaultBackoffMaxDelay, got)
+	}
+}
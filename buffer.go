@@ -0,0 +1,321 @@
+package togomq
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// OverflowPolicy is the behavior of a subscription when its prefetch buffer is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock stops reading from the stream until the consumer takes a message (default)
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest drops the oldest buffered message to make room for the new one
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDropNewest drops the new message
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	// OverflowSpill writes the messages that do not fit to a file and delivers them in order later.
+	// Spilled messages are decrypted, so it cannot be used with end-to-end encryption.
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+// validate checks if the overflow policy is supported
+func (p OverflowPolicy) validate() error {
+	switch p {
+	case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowSpill:
+		return nil
+	default:
+		return fmt.Errorf("unsupported overflow policy %q", string(p))
+	}
+}
+
+// BufferStats reports the occupancy of the prefetch buffer of a subscription
+type BufferStats struct {
+	// Size is the number of messages the buffer holds in memory
+	Size int
+	// Buffered is the number of messages waiting in memory for the consumer
+	Buffered int
+	// Spilled is the number of messages waiting on disk for the consumer
+	Spilled int
+	// Dropped is the number of messages dropped because the buffer was full
+	Dropped int64
+}
+
+// Pending returns the number of messages waiting for the consumer
+func (s BufferStats) Pending() int {
+	return s.Buffered + s.Spilled
+}
+
+// deliveryBuffer is the prefetch buffer between the subscribe stream and the message channel
+type deliveryBuffer struct {
+	out     chan *Message
+	policy  OverflowPolicy
+	dropped atomic.Int64
+	spill   *spillQueue // nil unless the policy is OverflowSpill
+}
+
+// newDeliveryBuffer creates the buffer of a subscription; the message channel holds size messages
+func newDeliveryBuffer(size int, policy OverflowPolicy, spillDir string) (*deliveryBuffer, error) {
+	b := &deliveryBuffer{out: make(chan *Message, size), policy: policy}
+	if policy == OverflowSpill {
+		spill, err := newSpillQueue(spillDir)
+		if err != nil {
+			return nil, err
+		}
+		b.spill = spill
+	}
+	return b, nil
+}
+
+// push hands a message to the consumer according to the overflow policy.
+// It returns an error when a message is dropped because it cannot be spilled.
+func (b *deliveryBuffer) push(ctx context.Context, msg *Message) error {
+	switch b.policy {
+	case OverflowDropNewest:
+		select {
+		case b.out <- msg:
+		default:
+			b.dropped.Add(1)
+		}
+		return nil
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case b.out <- msg:
+				return nil
+			default:
+			}
+			select {
+			case <-b.out:
+				b.dropped.Add(1)
+			default:
+			}
+		}
+
+	case OverflowSpill:
+		// A message that cannot be spilled is dropped: delivering it before the spilled ones
+		// would break their order
+		if _, err := b.spill.push(b.out, msg); err != nil {
+			b.dropped.Add(1)
+			return NewError(ErrCodeSubscribe, "failed to spill message, dropping it", err)
+		}
+		return nil
+
+	default:
+		select {
+		case b.out <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// run delivers the spilled messages until ctx is done or the buffer is closed and drained
+func (b *deliveryBuffer) run(ctx context.Context, closing <-chan struct{}, log *Logger) {
+	if b.spill == nil {
+		return
+	}
+	for {
+		for {
+			msg, size, ok, err := b.spill.peek()
+			if err != nil {
+				log.WithError(err).Error("Failed to read spilled messages, dropping them")
+				dropped, err := b.spill.reset()
+				b.dropped.Add(int64(dropped))
+				if err != nil {
+					log.WithError(err).Warn("Failed to truncate the spill file")
+				}
+				break
+			}
+			if !ok {
+				break
+			}
+			select {
+			case b.out <- msg:
+				if err := b.spill.advance(size); err != nil {
+					log.WithError(err).Warn("Failed to truncate the spill file")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-b.spill.notify:
+		case <-closing:
+			if b.spill.len() == 0 {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stats returns the occupancy of the buffer
+func (b *deliveryBuffer) stats() BufferStats {
+	stats := BufferStats{Size: cap(b.out), Buffered: len(b.out), Dropped: b.dropped.Load()}
+	if b.spill != nil {
+		stats.Spilled = b.spill.len()
+	}
+	return stats
+}
+
+// depth returns the number of messages waiting for the consumer
+func (b *deliveryBuffer) depth() int {
+	return b.stats().Pending()
+}
+
+// close removes the spill file
+func (b *deliveryBuffer) close() {
+	if b.spill != nil {
+		b.spill.close()
+	}
+}
+
+// spillQueue is a FIFO of messages in a temporary file, stored as length-prefixed protobuf
+type spillQueue struct {
+	mu       sync.Mutex
+	file     *os.File
+	readOff  int64
+	writeOff int64
+	// count includes the message being delivered, so that new messages queue behind it
+	count  int
+	notify chan struct{}
+}
+
+// newSpillQueue creates the spill file in dir, or the default temporary directory
+func newSpillQueue(dir string) (*spillQueue, error) {
+	file, err := os.CreateTemp(dir, "togomq-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	return &spillQueue{file: file, notify: make(chan struct{}, 1)}, nil
+}
+
+// push sends msg to out when nothing is spilled and out has room, otherwise it appends msg to the file.
+// It reports whether the message was spilled.
+func (q *spillQueue) push(out chan<- *Message, msg *Message) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count == 0 {
+		select {
+		case out <- msg:
+			return false, nil
+		default:
+		}
+	}
+
+	data, err := proto.Marshal(&mqv1.SubMessageResponse{
+		Topic:     msg.Topic,
+		Uuid:      msg.UUID,
+		Body:      msg.Body,
+		Variables: msg.Variables,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode spilled message: %w", err)
+	}
+	record := binary.AppendUvarint(nil, uint64(len(data)))
+	record = append(record, data...)
+	if _, err := q.file.WriteAt(record, q.writeOff); err != nil {
+		return false, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	q.writeOff += int64(len(record))
+	q.count++
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// peek reads the oldest spilled message and the size of its record
+func (q *spillQueue) peek() (*Message, int64, bool, error) {
+	q.mu.Lock()
+	count, off := q.count, q.readOff
+	q.mu.Unlock()
+	if count == 0 {
+		return nil, 0, false, nil
+	}
+
+	// Records before writeOff are complete, and only the delivering goroutine moves readOff
+	header := make([]byte, binary.MaxVarintLen64)
+	n, err := q.file.ReadAt(header, off)
+	if n == 0 {
+		return nil, 0, false, err
+	}
+	length, prefix := binary.Uvarint(header[:n])
+	if prefix <= 0 {
+		return nil, 0, false, fmt.Errorf("corrupted spill record at offset %d", off)
+	}
+	data := make([]byte, length)
+	if _, err := q.file.ReadAt(data, off+int64(prefix)); err != nil {
+		return nil, 0, false, err
+	}
+
+	resp := &mqv1.SubMessageResponse{}
+	if err := proto.Unmarshal(data, resp); err != nil {
+		return nil, 0, false, err
+	}
+	return fromSubResponse(resp), int64(prefix) + int64(length), true, nil
+}
+
+// advance removes the oldest record once its message is delivered.
+// The queue stays usable when the file cannot be truncated, only its disk space is not reclaimed.
+func (q *spillQueue) advance(size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.readOff += size
+	q.count--
+	if q.count == 0 {
+		// Reclaim the disk space once everything is delivered
+		q.readOff, q.writeOff = 0, 0
+		return q.file.Truncate(0)
+	}
+	return nil
+}
+
+// reset empties the queue and returns the number of discarded messages
+func (q *spillQueue) reset() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	count := q.count
+	q.count, q.readOff, q.writeOff = 0, 0, 0
+	return count, q.file.Truncate(0)
+}
+
+// len returns the number of spilled messages
+func (q *spillQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// close closes and removes the spill file
+func (q *spillQueue) close() {
+	q.file.Close()
+	os.Remove(q.file.Name())
+}
+
+// BufferStats returns the occupancy of the prefetch buffer of the subscription delivering on
+// messages, as returned by Sub, or the total of the buffers of SubMulti.
+// It returns false once the subscription has ended.
+func (c *Client) BufferStats(messages <-chan *Message) (BufferStats, bool) {
+	stats, ok := c.buffers.Load(messages)
+	if !ok {
+		return BufferStats{}, false
+	}
+	return stats.(func() BufferStats)(), true
+}
@@ -0,0 +1,211 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+// waitForBuffer polls the buffer stats of a subscription until cond holds
+func waitForBuffer(t *testing.T, client *Client, msgChan <-chan *Message, cond func(BufferStats) bool) BufferStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, ok := client.BufferStats(msgChan)
+		if ok && cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the buffer, got %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// receiveUUIDs reads n messages and returns their UUIDs
+func receiveUUIDs(t *testing.T, msgChan <-chan *Message, n int) []string {
+	t.Helper()
+	var uuids []string
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-msgChan:
+			if msg == nil {
+				t.Fatalf("Channel closed after %v", uuids)
+			}
+			uuids = append(uuids, msg.UUID)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after %v", uuids)
+		}
+	}
+	return uuids
+}
+
+func TestSub_BufferDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy   OverflowPolicy
+		expected string
+	}{
+		{OverflowDropNewest, "[0 1 2]"},
+		{OverflowDropOldest, "[7 8 9]"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			client := newTestClient(t, streamingSubServer(10))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("orders").WithBuffer(3, tt.policy))
+			if err != nil {
+				t.Fatalf("Sub failed: %v", err)
+			}
+			stats := waitForBuffer(t, client, msgChan, func(s BufferStats) bool { return s.Dropped == 7 })
+			if stats.Size != 3 || stats.Buffered != 3 || stats.Spilled != 0 {
+				t.Errorf("Unexpected stats %+v", stats)
+			}
+
+			if uuids := fmt.Sprint(receiveUUIDs(t, msgChan, 3)); uuids != tt.expected {
+				t.Errorf("Expected messages %s, got %s", tt.expected, uuids)
+			}
+		})
+	}
+}
+
+func TestSub_BufferSpill(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			for i := 0; i < 10; i++ {
+				err := stream.Send(&mqv1.SubMessageResponse{
+					Topic:     req.Topic,
+					Uuid:      fmt.Sprintf("%d", i),
+					Body:      []byte("body"),
+					Variables: map[string]string{"index": fmt.Sprint(i)},
+				})
+				if err != nil {
+					return err
+				}
+			}
+			// The stream ends with messages still spilled
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	dir := t.TempDir()
+
+	msgChan, errChan, err := client.Sub(context.Background(),
+		NewSubscribeOptions("orders").WithBuffer(2, OverflowSpill).WithSpillDir(dir))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	stats := waitForBuffer(t, client, msgChan, func(s BufferStats) bool { return s.Pending() == 10 })
+	if stats.Buffered != 2 || stats.Spilled != 8 || stats.Dropped != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected a spill file, got %d files", len(files))
+	}
+
+	// All messages are delivered in order before the channel is closed
+	var uuids []string
+	for msg := range msgChan {
+		if msg.Variables["index"] != msg.UUID || string(msg.Body) != "body" {
+			t.Errorf("Unexpected spilled message %+v", msg)
+		}
+		uuids = append(uuids, msg.UUID)
+	}
+	if fmt.Sprint(uuids) != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Errorf("Expected the messages in order, got %v", uuids)
+	}
+	if err := <-errChan; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the spill file to be removed, got %d files", len(files))
+	}
+	if _, ok := client.BufferStats(msgChan); ok {
+		t.Error("Expected no stats after the subscription ended")
+	}
+}
+
+func TestSpillQueue_Reuse(t *testing.T) {
+	q, err := newSpillQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("newSpillQueue failed: %v", err)
+	}
+	defer q.close()
+
+	full := make(chan *Message)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 3; i++ {
+			if spilled, err := q.push(full, &Message{Topic: "orders", UUID: fmt.Sprint(i)}); !spilled || err != nil {
+				t.Fatalf("Expected the message to be spilled, got %v %v", spilled, err)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			msg, size, ok, err := q.peek()
+			if !ok || err != nil || msg.UUID != fmt.Sprint(i) {
+				t.Fatalf("Expected message %d, got %+v %v", i, msg, err)
+			}
+			if err := q.advance(size); err != nil {
+				t.Fatalf("advance failed: %v", err)
+			}
+		}
+		// The file is truncated once drained
+		if info, _ := q.file.Stat(); info.Size() != 0 || q.len() != 0 {
+			t.Errorf("Expected an empty spill file, got %d bytes", info.Size())
+		}
+	}
+}
+
+func TestDeliveryBuffer_SpillWriteFailure(t *testing.T) {
+	b, err := newDeliveryBuffer(1, OverflowSpill, t.TempDir())
+	if err != nil {
+		t.Fatalf("newDeliveryBuffer failed: %v", err)
+	}
+	defer b.close()
+
+	if err := b.push(context.Background(), &Message{UUID: "1"}); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	b.spill.file.Close()
+
+	// The message is dropped instead of waiting for room in memory
+	err = b.push(context.Background(), &Message{UUID: "2"})
+	if decodeErrCode(err) != ErrCodeSubscribe {
+		t.Errorf("Expected a %s error, got %v", ErrCodeSubscribe, err)
+	}
+	if stats := b.stats(); stats.Buffered != 1 || stats.Spilled != 0 || stats.Dropped != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestSub_BufferSpillEncryption(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(0))
+	client.config.Encryption = &EncryptionOptions{}
+
+	opts := NewSubscribeOptions("orders").WithBuffer(10, OverflowSpill).WithSpillDir(t.TempDir())
+	if _, _, err := client.Sub(context.Background(), opts); decodeErrCode(err) != ErrCodeValidation {
+		t.Errorf("Expected a validation error for spilling decrypted messages, got %v", err)
+	}
+}
+
+func TestSub_BufferValidation(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(0))
+	for _, opts := range []*SubscribeOptions{
+		NewSubscribeOptions("orders").WithBuffer(0, OverflowDropOldest),
+		NewSubscribeOptions("orders").WithBuffer(10, "discard"),
+		NewSubscribeOptions("orders").WithBuffer(-1, OverflowBlock),
+	} {
+		if _, _, err := client.Sub(context.Background(), opts); decodeErrCode(err) != ErrCodeValidation {
+			t.Errorf("Expected a validation error for %+v, got %v", opts, err)
+		}
+	}
+
+	opts := NewSubscribeOptions("orders").WithBuffer(10, OverflowSpill).WithSpillDir("/nonexistent/spill")
+	if _, _, err := client.Sub(context.Background(), opts); decodeErrCode(err) != ErrCodeConfiguration {
+		t.Errorf("Expected a configuration error for a missing spill directory, got %v", err)
+	}
+}
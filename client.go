@@ -2,22 +2,53 @@ package togomq
 
 import (
 	"context"
+	"errors"
 	"io"
+	"log/slog"
+	"sync"
+	"time"
 
 	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
-	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 )
 
+// MessageQueue is the set of operations of a TogoMQ client.
+// It is implemented by *Client and can be replaced by a test double such as togomqtest.MockQueue.
+type MessageQueue interface {
+	Pub(ctx context.Context, messages <-chan *Message) (*PubResponse, error)
+	PubBatch(ctx context.Context, messages []*Message) (*PubResponse, error)
+	Sub(ctx context.Context, opts *SubscribeOptions) (<-chan *Message, <-chan error, error)
+	CountMessages(ctx context.Context, topic string) (int64, error)
+	Close() error
+}
+
+var _ MessageQueue = (*Client)(nil)
+
 // Client is the TogoMQ client
 type Client struct {
 	config *Config
 	conn   *grpc.ClientConn
 	client mqv1.MqServiceClient
 	logger *Logger
+
+	// endpoints records the server address of the last call
+	endpoints *endpointTracker
+
+	// buffers holds the buffer stats functions of the running subscriptions by message channel
+	buffers sync.Map
+
+	limiterOnce sync.Once
+	limiter     *rateLimiter
+
+	tokensOnce sync.Once
+	tokens     TokenSource
+
+	deadLettersOnce sync.Once
+	deadLetters     *deadLetterQueue
 }
 
 // NewClient creates a new TogoMQ client
@@ -31,12 +62,21 @@ func NewClient(config *Config) (*Client, error) {
 	}
 
 	logger := NewLogger(ParseLogLevel(config.LogLevel))
-	logger.Info("Creating TogoMQ client for %s", config.Address())
+	if config.Logger != nil {
+		logger = NewSlogLogger(config.Logger)
+	}
+	logger.With("address", config.Address()).Info("Creating TogoMQ client")
 
 	// Configure transport credentials based on UseTLS setting
 	var dialOpts []grpc.DialOption
 	if config.UseTLS {
 		creds := credentials.NewTLS(nil)
+		if config.TLS != nil {
+			var err error
+			if creds, err = config.TLS.credentials(logger); err != nil {
+				return nil, NewError(ErrCodeConfiguration, "invalid TLS configuration", err)
+			}
+		}
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(creds))
 		logger.Debug("Using TLS for connection")
 	} else {
@@ -60,27 +100,32 @@ func NewClient(config *Config) (*Client, error) {
 			PermitWithoutStream: false,
 		}),
 	)
+	c := &Client{
+		config:    config,
+		logger:    logger,
+		endpoints: &endpointTracker{},
+	}
+	target, resolverOpts := config.target()
+	dialOpts = append(dialOpts, resolverOpts...)
+	dialOpts = append(dialOpts,
+		grpc.WithPerRPCCredentials(tokenCredentials{client: c}),
+		grpc.WithStatsHandler(c.endpoints),
+	)
+	dialOpts = append(dialOpts, config.DialOptions...)
 
 	// Create gRPC connection with configured options
-	conn, err := grpc.NewClient(
-		config.Address(),
-		dialOpts...,
-	)
+	conn, err := grpc.NewClient(target, dialOpts...)
 	if err != nil {
-		logger.Error("Failed to connect to TogoMQ: %v", err)
+		logger.WithError(err).Error("Failed to connect to TogoMQ")
 		return nil, NewError(ErrCodeConnection, "failed to create gRPC connection", err)
 	}
 
-	client := mqv1.NewMqServiceClient(conn)
+	c.conn = conn
+	c.client = mqv1.NewMqServiceClient(conn)
 
 	logger.Info("TogoMQ client created successfully")
 
-	return &Client{
-		config: config,
-		conn:   conn,
-		client: client,
-		logger: logger,
-	}, nil
+	return c, nil
 }
 
 // Close closes the client connection
@@ -92,75 +137,236 @@ func (c *Client) Close() error {
 	return nil
 }
 
-// contextWithAuth adds authentication metadata to the context
-func (c *Client) contextWithAuth(ctx context.Context) context.Context {
-	md := metadata.New(map[string]string{
-		"authorization": c.config.Token,
-	})
-	return metadata.NewOutgoingContext(ctx, md)
+// Operation names attached to logs of the client calls
+const (
+	opPub           = "Pub"
+	opPubBatch      = "PubBatch"
+	opSub           = "Sub"
+	opCountMessages = "CountMessages"
+	opPublisher     = "Publisher"
+	opConsumer      = "Consumer"
+	opDeadLetter    = "DeadLetter"
+)
+
+// operationKey is the context key for the name of the running operation
+type operationKey struct{}
+
+// withOperation returns a context that carries the name of the running operation
+func withOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+// operation returns the name of the running operation carried by the context
+func operation(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
+
+// log returns the client logger with the operation carried by the context
+func (c *Client) log(ctx context.Context) *Logger {
+	if op := operation(ctx); op != "" {
+		return c.logger.With(LogKeyOperation, op)
+	}
+	return c.logger
 }
 
 // Pub publishes messages to TogoMQ using a streaming approach
-// Messages are sent through the provided channel and the function returns when the channel is closed
+// Messages are sent through the provided channel and the function returns when the channel is closed.
+// On failure the returned PubResponse reports how far the stream got; messages that were not yet
+// read from the channel remain in it.
 func (c *Client) Pub(ctx context.Context, messages <-chan *Message) (*PubResponse, error) {
-	c.logger.Debug("Starting Pub operation")
+	ctx = withOperation(ctx, opPub)
+	c.log(ctx).Debug("Starting Pub operation")
+
+	ctx, span := c.startPublishSpan(ctx)
+	start := time.Now()
+	resp, err := c.pub(ctx, messages)
+	c.metrics().PublishLatency(opPub, time.Since(start))
+	endPublishSpan(span, resp, err)
+	return resp, err
+}
+
+// pub opens a publish stream and sends the messages from the channel
+func (c *Client) pub(ctx context.Context, messages <-chan *Message) (*PubResponse, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Create the stream; messages read from the channel cannot be replayed,
+	// so only the stream creation is retried
+	var stream mqv1.MqService_PubMessageClient
+	err := c.withRetry(ctx, false, func(ctx context.Context) error {
+		var err error
+		stream, err = c.openPubStream(streamCtx)
+		return err
+	})
+	if err != nil {
+		return &PubResponse{}, err
+	}
 
-	// Add authentication to context
-	ctx = c.contextWithAuth(ctx)
+	return c.sendMessages(stream, messages, false)
+}
 
-	// Create the stream
+// PubBatch publishes a batch of messages.
+// An attempt that wrote messages to the stream is only retried when the server failed the stream,
+// not when the client aborted it, so that no message is published twice. On failure the returned
+// PubResponse reports how far the last attempt got: its Unsent field holds messages[FirstUnsentIndex:],
+// and Uncertain the messages written to the failed stream.
+func (c *Client) PubBatch(ctx context.Context, messages []*Message) (*PubResponse, error) {
+	ctx = withOperation(ctx, opPubBatch)
+	c.log(ctx).With(LogKeyCount, len(messages)).Debug("Publishing batch")
+
+	ctx, span := c.startPublishSpan(ctx)
+	start := time.Now()
+	resp, err := c.pubBatch(ctx, messages)
+	c.metrics().PublishLatency(opPubBatch, time.Since(start))
+	endPublishSpan(span, resp, err)
+	return resp, err
+}
+
+// pubBatch publishes the batch, retrying it according to the retry policy
+func (c *Client) pubBatch(ctx context.Context, messages []*Message) (*PubResponse, error) {
+	var resp *PubResponse
+	err := c.withRetry(ctx, true, func(ctx context.Context) error {
+		// Every attempt has its own stream, cancelled when the attempt ends
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		resp = &PubResponse{}
+		stream, err := c.openPubStream(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Create a channel and send messages
+		msgChan := make(chan *Message, len(messages))
+		for _, msg := range messages {
+			msgChan <- msg
+		}
+		close(msgChan)
+
+		resp, err = c.sendMessages(stream, msgChan, true)
+		if err != nil && resp.MessagesSent > 0 && !serverFailed(err) {
+			// The server may have stored the messages written to the aborted stream
+			return finalError{err}
+		}
+		return err
+	})
+	if err != nil {
+		resp.Unsent = messages[resp.FirstUnsentIndex:]
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+// serverFailed reports whether err carries the gRPC status of a failed call, rather than a client error
+func serverFailed(err error) bool {
+	var tmqErr *TogoMQError
+	return errors.As(err, &tmqErr) && tmqErr.Status != nil
+}
+
+// openPubStream creates a publish stream
+func (c *Client) openPubStream(ctx context.Context) (mqv1.MqService_PubMessageClient, error) {
 	stream, err := c.client.PubMessage(ctx)
 	if err != nil {
-		c.logger.Error("Failed to create pub stream: %v", err)
-		return nil, WrapGRPCError(err, "failed to create publish stream")
+		c.log(ctx).WithError(err).Error("Failed to create pub stream")
+		return nil, c.wrapError(ctx, err, "failed to create publish stream")
 	}
+	return stream, nil
+}
 
-	// Send messages
-	messageCount := 0
-	for msg := range messages {
+// publishHandler returns the handler that runs the publish middleware and sends messages on the stream
+func (c *Client) publishHandler(stream mqv1.MqService_PubMessageClient) Handler {
+	send := HandlerFunc(func(ctx context.Context, msg *Message) error {
 		// Validate that topic is specified
 		if msg.Topic == "" {
-			c.logger.Error("Message topic is required")
-			return nil, NewError(ErrCodeValidation, "message topic is required", nil)
+			c.log(ctx).Error("Message topic is required")
+			return NewError(ErrCodeValidation, "message topic is required", nil)
 		}
 
-		c.logger.Debug("Publishing message to topic: %s", msg.Topic)
+		if c.logger.enabled(slog.LevelDebug) {
+			c.log(ctx).With(LogKeyTopic, msg.Topic).Debug("Publishing message")
+		}
 
-		if err := stream.Send(msg.toPubRequest()); err != nil {
-			c.logger.Error("Failed to send message: %v", err)
-			return nil, WrapGRPCError(err, "failed to send message")
+		req := msg.toPubRequest()
+		if err := stream.Send(req); err != nil {
+			// The stream was aborted by the server, its status is reported by CloseAndRecv
+			if err == io.EOF {
+				if _, recvErr := stream.CloseAndRecv(); recvErr != nil {
+					err = recvErr
+				}
+			}
+			c.log(ctx).With(LogKeyTopic, msg.Topic).WithError(err).Error("Failed to send message")
+			return c.wrapError(ctx, err, "failed to send message")
 		}
-		messageCount++
-	}
+		c.metrics().MessagePublished(msg.Topic, proto.Size(req))
+		return nil
+	})
 
-	c.logger.Info("Sent %d messages, waiting for response", messageCount)
+	return chain(c.publishMiddleware(), send)
+}
 
-	// Close and receive response
-	resp, err := stream.CloseAndRecv()
+// sendMessage runs a single message through the publish handler.
+// It reports whether a middleware skipped the message.
+func (c *Client) sendMessage(ctx context.Context, publish Handler, msg *Message) (bool, error) {
+	err := publish.Handle(ctx, msg)
+	if errors.Is(err, ErrSkipMessage) {
+		if c.logger.enabled(slog.LevelDebug) {
+			c.log(ctx).With(LogKeyTopic, msg.Topic).Debug("Message skipped by publish middleware")
+		}
+		return true, nil
+	}
 	if err != nil {
-		c.logger.Error("Failed to receive pub response: %v", err)
-		return nil, WrapGRPCError(err, "failed to receive publish response")
+		var tmqErr *TogoMQError
+		if !errors.As(err, &tmqErr) {
+			c.log(ctx).With(LogKeyTopic, msg.Topic).WithError(err).Error("Message rejected by publish middleware")
+			err = NewError(ErrCodePublish, "message rejected by publish middleware", err)
+		}
+		return false, err
 	}
-
-	c.logger.Info("Publish completed: %d messages received by server", resp.MessagesReceived)
-
-	return &PubResponse{
-		MessagesReceived: resp.MessagesReceived,
-	}, nil
+	return false, nil
 }
 
-// PubBatch publishes a batch of messages
-func (c *Client) PubBatch(ctx context.Context, messages []*Message) (*PubResponse, error) {
-	c.logger.Debug("Publishing batch of %d messages", len(messages))
+// sendMessages sends all messages from the channel on the stream and waits for the server response.
+// The response is always returned and tracks the progress of the stream on failure. When track is set,
+// the messages written to a stream that fails are kept and reported as Uncertain.
+func (c *Client) sendMessages(stream mqv1.MqService_PubMessageClient, messages <-chan *Message, track bool) (*PubResponse, error) {
+	result := &PubResponse{}
+	var written []*Message
+	publish := c.publishHandler(stream)
+	for msg := range messages {
+		skipped, err := c.sendMessage(stream.Context(), publish, msg)
+		if err != nil {
+			result.Unsent = []*Message{msg}
+			result.Uncertain = written
+			return result, err
+		}
+		if skipped {
+			result.MessagesSkipped++
+		} else {
+			result.MessagesSent++
+			if track {
+				written = append(written, msg)
+			}
+		}
+		result.FirstUnsentIndex++
+	}
+
+	log := c.log(stream.Context())
+	log.With(LogKeyCount, result.MessagesSent).Info("Sent messages, waiting for response")
 
-	// Create a channel and send messages
-	msgChan := make(chan *Message, len(messages))
-	for _, msg := range messages {
-		msgChan <- msg
+	// Close and receive response
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		log.WithError(err).Error("Failed to receive pub response")
+		result.Uncertain = written
+		return result, c.wrapError(stream.Context(), err, "failed to receive publish response")
 	}
-	close(msgChan)
 
-	return c.Pub(ctx, msgChan)
+	log.With(LogKeyCount, resp.MessagesReceived).Info("Publish completed, messages received by server")
+
+	result.MessagesReceived = resp.MessagesReceived
+	return result, nil
 }
 
 // Sub subscribes to messages from TogoMQ.
@@ -171,64 +377,209 @@ func (c *Client) Sub(ctx context.Context, opts *SubscribeOptions) (<-chan *Messa
 	if opts.Topic == "" {
 		return nil, nil, NewError(ErrCodeValidation, "topic is required for subscription", nil)
 	}
+	if opts.FlowControl != nil {
+		if err := opts.FlowControl.validate(); err != nil {
+			return nil, nil, NewError(ErrCodeValidation, "invalid flow control options", err)
+		}
+	}
+	if err := opts.validateBuffer(); err != nil {
+		return nil, nil, NewError(ErrCodeValidation, "invalid buffer options", err)
+	}
+	if opts.Overflow == OverflowSpill && c.config.Encryption != nil {
+		return nil, nil, NewError(ErrCodeValidation, "overflow policy spill cannot be used with encryption, it would write decrypted messages to disk", nil)
+	}
 
-	c.logger.Debug("Starting Sub operation for topic: %s", opts.Topic)
-	// Add authentication to context
-	ctx = c.contextWithAuth(ctx)
+	ctx = withOperation(ctx, opSub)
+	log := c.log(ctx).With(LogKeyTopic, opts.Topic)
+	log.Debug("Starting Sub operation")
+
+	// The flow control negotiates its own values on a copy of the options
+	var flow *flowController
+	if opts.FlowControl != nil {
+		flow = newFlowController(opts.FlowControl, opts, time.Now())
+		negotiated := *opts
+		flow.apply(&negotiated)
+		opts = &negotiated
+	}
+
+	// Messages are prefetched in the message channel, by default as many as flow control measures
+	bufferSize := opts.BufferSize
+	if flow != nil {
+		if bufferSize == 0 {
+			bufferSize = flow.opts.QueueSize
+		}
+		flow.opts.QueueSize = bufferSize
+	}
+	buffer, err := newDeliveryBuffer(bufferSize, opts.Overflow, opts.SpillDir)
+	if err != nil {
+		return nil, nil, NewError(ErrCodeConfiguration, "failed to create prefetch buffer", err)
+	}
+
+	// Every stream has its own context, cancelled when the stream is replaced.
+	// The flow control stops the stream from its own goroutine.
+	var streamMu sync.Mutex
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	newStreamCtx := func() context.Context {
+		streamMu.Lock()
+		defer streamMu.Unlock()
+		cancelStream()
+		streamCtx, cancelStream = context.WithCancel(ctx)
+		return streamCtx
+	}
+	stopStream := func() {
+		streamMu.Lock()
+		defer streamMu.Unlock()
+		cancelStream()
+	}
 
 	// Create the stream
-	stream, err := c.client.SubMessage(ctx, opts.toSubRequest())
+	var stream mqv1.MqService_SubMessageClient
+	err = c.withRetry(ctx, false, func(ctx context.Context) error {
+		var err error
+		stream, err = c.client.SubMessage(streamCtx, opts.toSubRequest())
+		if err != nil {
+			log.WithError(err).Error("Failed to create sub stream")
+			return c.wrapError(ctx, err, "failed to create subscribe stream")
+		}
+		return nil
+	})
 	if err != nil {
-		c.logger.Error("Failed to create sub stream: %v", err)
-		return nil, nil, WrapGRPCError(err, "failed to create subscribe stream")
+		stopStream()
+		buffer.close()
+		return nil, nil, err
 	}
 
 	// Create channels for messages and errors
-	messageChan := make(chan *Message)
+	messageChan := buffer.out
 	errorChan := make(chan error, 1)
+	c.buffers.Store((<-chan *Message)(messageChan), buffer.stats)
+
+	// Deliver messages through the consume middleware into the buffer
+	deliver := HandlerFunc(func(ctx context.Context, msg *Message) error {
+		return buffer.push(ctx, msg)
+	})
+	consume := chain(c.consumeMiddleware(), deliver)
+
+	// Spilled messages are delivered by their own goroutine
+	closing := make(chan struct{})
+	spillDone := make(chan struct{})
+	go func() {
+		defer close(spillDone)
+		buffer.run(ctx, closing, log)
+	}()
+	if flow != nil {
+		go c.runFlowControl(ctx, closing, flow, opts.Topic, buffer.depth, stopStream)
+	}
 
 	// Start goroutine to receive messages
+	c.metrics().SubscriptionStarted(opts.Topic)
 	go func() {
 		defer close(messageChan)
+		defer func() {
+			// Deliver the spilled messages before closing the message channel
+			close(closing)
+			<-spillDone
+			buffer.close()
+			c.buffers.Delete((<-chan *Message)(messageChan))
+		}()
 		defer close(errorChan)
+		defer c.metrics().SubscriptionStopped(opts.Topic)
+		defer stopStream()
 
 		messageCount := 0
+		attempt := 0
+		refreshed := false
 		for {
 			resp, err := stream.Recv()
-			if err == io.EOF {
-				c.logger.Info("Subscribe stream ended, received %d messages", messageCount)
-				return
-			}
 			if err != nil {
-				c.logger.Error("Failed to receive message: %v", err)
-				errorChan <- WrapGRPCError(err, "failed to receive message")
-				return
+				// The flow control stopped the stream to re-open it with the negotiated values
+				if flow != nil && ctx.Err() == nil && flow.renegotiate() {
+					flow.apply(opts)
+					log.With("speed_per_sec", opts.SpeedPerSec, "batch", opts.Batch).Info("Re-negotiated the subscription rate")
+					if stream, err = c.client.SubMessage(newStreamCtx(), opts.toSubRequest()); err == nil {
+						continue
+					}
+				}
+				// An expired token is refreshed once, then the stream is re-opened
+				if !refreshed && ctx.Err() == nil && c.refreshToken(ctx, err) {
+					refreshed = true
+					if reopened, err := c.client.SubMessage(newStreamCtx(), opts.toSubRequest()); err == nil {
+						stream = reopened
+						continue
+					}
+				}
+				if opts.Reconnect == nil || ctx.Err() != nil {
+					if err == io.EOF {
+						log.With(LogKeyCount, messageCount).Info("Subscribe stream ended")
+						return
+					}
+					log.WithError(err).Error("Failed to receive message")
+					errorChan <- c.wrapError(ctx, err, "failed to receive message")
+					return
+				}
+
+				// Resilient mode: re-open the stream and keep the channels open
+				cause := c.wrapError(ctx, err, "failed to receive message")
+				if err == io.EOF {
+					cause = NewError(ErrCodeStream, "subscribe stream ended by server", nil)
+				}
+				stream, err = c.reconnectSub(newStreamCtx(), opts, &attempt, cause)
+				if err != nil {
+					if ctx.Err() != nil {
+						log.Info("Context cancelled, stopping subscription")
+						return
+					}
+					errorChan <- err
+					return
+				}
+				continue
 			}
+			attempt = 0
+			refreshed = false
 
-			c.logger.Debug("Received message from topic: %s, UUID: %s", resp.Topic, resp.Uuid)
+			if c.logger.enabled(slog.LevelDebug) {
+				log.With(LogKeyTopic, resp.Topic, LogKeyUUID, resp.Uuid).Debug("Received message")
+			}
 			messageCount++
+			c.metrics().MessageReceived(resp.Topic, proto.Size(resp))
 
 			msg := fromSubResponse(resp)
 
-			select {
-			case messageChan <- msg:
-				// Message sent successfully
-			case <-ctx.Done():
-				c.logger.Info("Context cancelled, stopping subscription")
-				return
+			received := time.Now()
+			if err := consume.Handle(ctx, msg); err != nil {
+				if ctx.Err() != nil {
+					log.Info("Context cancelled, stopping subscription")
+					return
+				}
+				c.consumeError(ctx, msg, err)
+			}
+
+			if flow != nil {
+				flow.observe(time.Since(received), buffer.depth())
 			}
 		}
 	}()
 
-	if opts.Topic == "" {
-		c.logger.Info("Subscribe stream started for all topics (wildcard)")
-	} else {
-		c.logger.Info("Subscribe stream started for topic: %s", opts.Topic)
-	}
+	log.Info("Subscribe stream started")
 
 	return messageChan, errorChan, nil
 }
 
+// consumeError reports a message rejected by the consume middleware
+func (c *Client) consumeError(ctx context.Context, msg *Message, err error) {
+	if errors.Is(err, ErrSkipMessage) {
+		if c.logger.enabled(slog.LevelDebug) {
+			c.log(ctx).With(LogKeyTopic, msg.Topic, LogKeyUUID, msg.UUID).Debug("Message skipped by consume middleware")
+		}
+		return
+	}
+
+	c.log(ctx).With(LogKeyTopic, msg.Topic, LogKeyUUID, msg.UUID).WithError(err).Warn("Message rejected by consume middleware")
+	if c.config.ConsumeErrorHandler != nil {
+		c.config.ConsumeErrorHandler(msg, err)
+	}
+}
+
 // CountMessages counts the number of messages in a topic.
 // Topic can use wildcards (e.g., "orders.*" or "*" for all topics).
 // Returns the total count of messages matching the topic pattern.
@@ -238,10 +589,9 @@ func (c *Client) CountMessages(ctx context.Context, topic string) (int64, error)
 		return 0, NewError(ErrCodeValidation, "topic is required for counting messages", nil)
 	}
 
-	c.logger.Debug("Counting messages for topic: %s", topic)
-
-	// Add authentication to context
-	ctx = c.contextWithAuth(ctx)
+	ctx = withOperation(ctx, opCountMessages)
+	log := c.log(ctx).With(LogKeyTopic, topic)
+	log.Debug("Counting messages")
 
 	// Create the request
 	req := &mqv1.CountMessagesRequest{
@@ -249,13 +599,21 @@ func (c *Client) CountMessages(ctx context.Context, topic string) (int64, error)
 	}
 
 	// Call the gRPC method
-	resp, err := c.client.CountMessages(ctx, req)
+	var resp *mqv1.CountMessagesResponse
+	err := c.withRetry(ctx, true, func(ctx context.Context) error {
+		var err error
+		resp, err = c.client.CountMessages(ctx, req)
+		if err != nil {
+			log.WithError(err).Error("Failed to count messages")
+			return c.wrapError(ctx, err, "failed to count messages")
+		}
+		return nil
+	})
 	if err != nil {
-		c.logger.Error("Failed to count messages: %v", err)
-		return 0, WrapGRPCError(err, "failed to count messages")
+		return 0, err
 	}
 
-	c.logger.Info("Counted %d messages for topic: %s", resp.MessagesCount, topic)
+	log.With(LogKeyCount, resp.MessagesCount).Info("Counted messages")
 
 	return resp.MessagesCount, nil
 }
@@ -2,9 +2,99 @@ package togomq
 
 import (
 	"context"
+	"net"
+	"sync"
 	"testing"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
+// fakeServer is a scriptable MqServiceServer used by the client tests
+type fakeServer struct {
+	mqv1.UnimplementedMqServiceServer
+
+	mu         sync.Mutex
+	subCalls   int
+	pubCalls   int
+	countCalls int
+
+	// subFunc handles the n-th SubMessage call (starting at 1)
+	subFunc func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error
+	// pubFunc handles the n-th PubMessage call (starting at 1)
+	pubFunc func(call int, stream mqv1.MqService_PubMessageServer) error
+	// countFunc handles the n-th CountMessages call (starting at 1)
+	countFunc func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error)
+}
+
+func (f *fakeServer) SubMessage(req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+	f.mu.Lock()
+	f.subCalls++
+	call := f.subCalls
+	f.mu.Unlock()
+	return f.subFunc(call, req, stream)
+}
+
+func (f *fakeServer) PubMessage(stream mqv1.MqService_PubMessageServer) error {
+	f.mu.Lock()
+	f.pubCalls++
+	call := f.pubCalls
+	f.mu.Unlock()
+	return f.pubFunc(call, stream)
+}
+
+func (f *fakeServer) CountMessages(ctx context.Context, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+	f.mu.Lock()
+	f.countCalls++
+	call := f.countCalls
+	f.mu.Unlock()
+	return f.countFunc(ctx, call, req)
+}
+
+func (f *fakeServer) calls() (sub, pub int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subCalls, f.pubCalls
+}
+
+// newTestClient starts srv on an in-memory listener and returns a client connected to it
+func newTestClient(t *testing.T, srv mqv1.MqServiceServer) *Client {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	mqv1.RegisterMqServiceServer(s, srv)
+	go s.Serve(lis)
+
+	client := &Client{
+		config: NewConfig(WithToken("test-token")),
+		logger: NewLogger(LogLevelNone),
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(tokenCredentials{client: client}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create test connection: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+	})
+
+	client.conn = conn
+	client.client = mqv1.NewMqServiceClient(conn)
+	return client
+}
+
 func TestCountMessages_Validation(t *testing.T) {
 	// Create a client with default config (won't actually connect)
 	cfg := NewConfig(WithToken("test-token"))
@@ -30,3 +120,88 @@ func TestCountMessages_Validation(t *testing.T) {
 		}
 	})
 }
+
+func TestPubBatch_PartialFailure(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+
+	messages := []*Message{
+		NewMessage("orders", []byte("1")),
+		NewMessage("orders", []byte("2")),
+		{Body: []byte("missing topic")},
+		NewMessage("orders", []byte("4")),
+	}
+
+	resp, err := client.PubBatch(context.Background(), messages)
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodeValidation {
+		t.Fatalf("Expected %s error, got %v", ErrCodeValidation, err)
+	}
+	if resp == nil {
+		t.Fatal("Expected response with partial results, got nil")
+	}
+	if resp.MessagesSent != 2 {
+		t.Errorf("Expected 2 messages sent, got %d", resp.MessagesSent)
+	}
+	if resp.FirstUnsentIndex != 2 {
+		t.Errorf("Expected first unsent index 2, got %d", resp.FirstUnsentIndex)
+	}
+	if len(resp.Unsent) != 2 || resp.Unsent[0] != messages[2] || resp.Unsent[1] != messages[3] {
+		t.Errorf("Expected the last 2 messages to be unsent, got %v", resp.Unsent)
+	}
+}
+
+func TestPub_PartialFailure(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+
+	invalid := &Message{Body: []byte("missing topic")}
+	msgChan := make(chan *Message, 3)
+	msgChan <- NewMessage("orders", []byte("1"))
+	msgChan <- invalid
+	msgChan <- NewMessage("orders", []byte("3"))
+	close(msgChan)
+
+	resp, err := client.Pub(context.Background(), msgChan)
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if resp.MessagesSent != 1 || resp.FirstUnsentIndex != 1 {
+		t.Errorf("Expected 1 message sent, got %d (first unsent %d)", resp.MessagesSent, resp.FirstUnsentIndex)
+	}
+	if len(resp.Unsent) != 1 || resp.Unsent[0] != invalid {
+		t.Errorf("Expected the invalid message to be unsent, got %v", resp.Unsent)
+	}
+	if len(msgChan) != 1 {
+		t.Errorf("Expected 1 message left in the channel, got %d", len(msgChan))
+	}
+}
+
+func TestPubBatch_ServerFailure(t *testing.T) {
+	srv := &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			stream.Recv()
+			return status.Error(codes.Unavailable, "server shutting down")
+		},
+	}
+	client := newTestClient(t, srv)
+
+	messages := make([]*Message, 200)
+	for i := range messages {
+		messages[i] = NewMessage("orders", make([]byte, 64*1024))
+	}
+
+	resp, err := client.PubBatch(context.Background(), messages)
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodeConnection {
+		t.Fatalf("Expected %s error, got %v", ErrCodeConnection, err)
+	}
+	if resp.FirstUnsentIndex != resp.MessagesSent {
+		t.Errorf("Expected first unsent index %d, got %d", resp.MessagesSent, resp.FirstUnsentIndex)
+	}
+	if resp.MessagesSent+len(resp.Unsent) != len(messages) {
+		t.Errorf("Expected sent and unsent messages to add up to %d, got %d + %d",
+			len(messages), resp.MessagesSent, len(resp.Unsent))
+	}
+	if resp.MessagesReceived != 0 {
+		t.Errorf("Expected no messages received, got %d", resp.MessagesReceived)
+	}
+}
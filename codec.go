@@ -0,0 +1,229 @@
+package togomq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// VariableContentType is the reserved message variable holding the content type of the body
+const VariableContentType = "content-type"
+
+// Content types of the built-in codecs
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeRaw      = "application/octet-stream"
+)
+
+// Codec encodes values to message bodies and decodes them back
+type Codec interface {
+	// ContentType is the value stored in the content-type variable of encoded messages
+	ContentType() string
+	// Marshal encodes v
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes data into the value pointed to by v
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes values with encoding/json
+type JSONCodec struct{}
+
+// ContentType returns application/json
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal decodes JSON into v
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// ProtoCodec encodes protobuf messages in the binary wire format
+type ProtoCodec struct{}
+
+// ContentType returns application/x-protobuf
+func (ProtoCodec) ContentType() string { return ContentTypeProtobuf }
+
+// Marshal encodes v, which must be a proto.Message
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal decodes data into v, which must be a proto.Message or a pointer to one;
+// a nil message pointed to by v is allocated
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Elem().Kind() == reflect.Pointer {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if m, ok := elem.Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, m); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+}
+
+// RawCodec passes bodies through unchanged
+type RawCodec struct{}
+
+// ContentType returns application/octet-stream
+func (RawCodec) ContentType() string { return ContentTypeRaw }
+
+// Marshal returns v, which must be a []byte or a string
+func (RawCodec) Marshal(v any) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	default:
+		return nil, fmt.Errorf("raw codec: cannot encode %T", v)
+	}
+}
+
+// Unmarshal stores data in v, which must be a *[]byte or a *string
+func (RawCodec) Unmarshal(data []byte, v any) error {
+	switch p := v.(type) {
+	case *[]byte:
+		*p = data
+	case *string:
+		*p = string(data)
+	default:
+		return fmt.Errorf("raw codec: cannot decode into %T", v)
+	}
+	return nil
+}
+
+// builtinCodecs are the codecs looked up by content type after the ones given by the caller
+var builtinCodecs = []Codec{JSONCodec{}, ProtoCodec{}, RawCodec{}}
+
+// EncodeMessage encodes v with the codec (JSON when nil) into a message for the topic
+// and records the codec content type in its variables
+func EncodeMessage(codec Codec, topic string, v any) (*Message, error) {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return nil, NewError(ErrCodeValidation, "failed to encode message body", err)
+	}
+
+	msg := NewMessage(topic, body)
+	msg.Variables[VariableContentType] = codec.ContentType()
+	return msg, nil
+}
+
+// DecodeMessage decodes the body of msg with the codec matching its content-type variable.
+// The codecs are looked up before the built-in ones; a message without content type is decoded
+// with the first codec, or JSON when none is given. Failures return an ErrCodeDecode error.
+func DecodeMessage[T any](msg *Message, codecs ...Codec) (T, error) {
+	var value T
+
+	codec, err := lookupCodec(msg.Variables[VariableContentType], codecs)
+	if err != nil {
+		return value, NewError(ErrCodeDecode, fmt.Sprintf("cannot decode message %s", msg.UUID), err)
+	}
+	if err := codec.Unmarshal(msg.Body, &value); err != nil {
+		return value, NewError(ErrCodeDecode, fmt.Sprintf("cannot decode message %s", msg.UUID), err)
+	}
+	return value, nil
+}
+
+// lookupCodec returns the codec for a content type, ignoring its parameters
+func lookupCodec(contentType string, codecs []Codec) (Codec, error) {
+	if contentType == "" {
+		if len(codecs) > 0 {
+			return codecs[0], nil
+		}
+		return JSONCodec{}, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	for _, list := range [][]Codec{codecs, builtinCodecs} {
+		for _, codec := range list {
+			if codec.ContentType() == mediaType {
+				return codec, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no codec for content type %q", contentType)
+}
+
+// TypedMessage is a received message with its decoded body
+type TypedMessage[T any] struct {
+	*Message
+	// Value is the decoded body
+	Value T
+}
+
+// PublishTyped encodes the values with the codec (JSON when nil) and publishes them to the topic
+func PublishTyped[T any](ctx context.Context, q MessageQueue, codec Codec, topic string, values ...T) (*PubResponse, error) {
+	messages := make([]*Message, 0, len(values))
+	for _, v := range values {
+		msg, err := EncodeMessage(codec, topic, v)
+		if err != nil {
+			return &PubResponse{}, err
+		}
+		messages = append(messages, msg)
+	}
+	return q.PubBatch(ctx, messages)
+}
+
+// SubscribeTyped subscribes and decodes every received message with DecodeMessage.
+// Messages that cannot be decoded are dropped and passed with their ErrCodeDecode error to
+// onDecodeError, which may be nil to ignore them. The error channel only reports the error
+// ending the subscription, as with Sub.
+func SubscribeTyped[T any](ctx context.Context, q MessageQueue, opts *SubscribeOptions, onDecodeError func(msg *Message, err error), codecs ...Codec) (<-chan TypedMessage[T], <-chan error, error) {
+	msgChan, errChan, err := q.Sub(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	typedChan := make(chan TypedMessage[T])
+	typedErrChan := make(chan error, 1)
+	go func() {
+		defer close(typedChan)
+		defer close(typedErrChan)
+
+		for msg := range msgChan {
+			value, err := DecodeMessage[T](msg, codecs...)
+			if err != nil {
+				if onDecodeError != nil {
+					onDecodeError(msg, err)
+				}
+				continue
+			}
+
+			select {
+			case typedChan <- TypedMessage[T]{Message: msg, Value: value}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err, ok := <-errChan; ok {
+			select {
+			case typedErrChan <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return typedChan, typedErrChan, nil
+}
@@ -0,0 +1,194 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+// decodeErrCode returns the code of a TogoMQError, or "" for other errors
+func decodeErrCode(err error) ErrorCode {
+	var tmqErr *TogoMQError
+	if errors.As(err, &tmqErr) {
+		return tmqErr.Code
+	}
+	return ""
+}
+
+func TestCodec_JSONRoundTrip(t *testing.T) {
+	msg, err := EncodeMessage(nil, "orders", order{ID: "1", Amount: 5})
+	if err != nil {
+		t.Fatalf("EncodeMessage failed: %v", err)
+	}
+	if msg.Variables[VariableContentType] != ContentTypeJSON {
+		t.Errorf("Expected JSON content type, got %q", msg.Variables[VariableContentType])
+	}
+
+	decoded, err := DecodeMessage[order](msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage failed: %v", err)
+	}
+	if decoded != (order{ID: "1", Amount: 5}) {
+		t.Errorf("Unexpected decoded value: %+v", decoded)
+	}
+}
+
+func TestCodec_ProtoRoundTrip(t *testing.T) {
+	msg, err := EncodeMessage(ProtoCodec{}, "orders", wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatalf("EncodeMessage failed: %v", err)
+	}
+	if msg.Variables[VariableContentType] != ContentTypeProtobuf {
+		t.Errorf("Expected protobuf content type, got %q", msg.Variables[VariableContentType])
+	}
+
+	decoded, err := DecodeMessage[*wrapperspb.StringValue](msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage failed: %v", err)
+	}
+	if decoded.GetValue() != "hello" {
+		t.Errorf("Expected hello, got %q", decoded.GetValue())
+	}
+
+	if _, err := EncodeMessage(ProtoCodec{}, "orders", order{}); decodeErrCode(err) != ErrCodeValidation {
+		t.Errorf("Expected validation error for a non-proto value, got %v", err)
+	}
+}
+
+func TestCodec_Raw(t *testing.T) {
+	msg, err := EncodeMessage(RawCodec{}, "logs", "line")
+	if err != nil {
+		t.Fatalf("EncodeMessage failed: %v", err)
+	}
+
+	decoded, err := DecodeMessage[string](msg)
+	if err != nil {
+		t.Fatalf("DecodeMessage failed: %v", err)
+	}
+	if decoded != "line" {
+		t.Errorf("Expected line, got %q", decoded)
+	}
+}
+
+func TestDecodeMessage_ContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		codecs      []Codec
+		wantErr     bool
+	}{
+		{"json", "application/json", `{"id":"1"}`, nil, false},
+		{"parameters ignored", "application/json; charset=utf-8", `{"id":"1"}`, nil, false},
+		{"missing defaults to json", "", `{"id":"1"}`, nil, false},
+		{"missing uses first codec", "", `{"id":"1"}`, []Codec{RawCodec{}}, true},
+		{"unknown", "application/xml", `<id>1</id>`, nil, true},
+		{"invalid", "not a type;;", `{"id":"1"}`, nil, true},
+		{"malformed body", "application/json", `{"id":`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewMessage("orders", []byte(tt.body))
+			if tt.contentType != "" {
+				msg.Variables[VariableContentType] = tt.contentType
+			}
+
+			decoded, err := DecodeMessage[order](msg, tt.codecs...)
+			if tt.wantErr {
+				if decodeErrCode(err) != ErrCodeDecode {
+					t.Errorf("Expected decode error, got %v", err)
+				}
+				return
+			}
+			if err != nil || decoded.ID != "1" {
+				t.Errorf("Expected order 1, got %+v, %v", decoded, err)
+			}
+		})
+	}
+}
+
+func TestPublishTyped(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+
+	resp, err := PublishTyped(context.Background(), client, nil, "orders", order{ID: "1"}, order{ID: "2"})
+	if err != nil {
+		t.Fatalf("PublishTyped failed: %v", err)
+	}
+	if resp.MessagesReceived != 2 {
+		t.Errorf("Expected 2 messages received, got %d", resp.MessagesReceived)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, req := range received {
+		if req.Variables[VariableContentType] != ContentTypeJSON {
+			t.Errorf("Message %d: expected JSON content type, got %v", i, req.Variables)
+		}
+	}
+	if string(received[1].Body) != `{"id":"2","amount":0}` {
+		t.Errorf("Unexpected body: %s", received[1].Body)
+	}
+}
+
+func TestSubscribeTyped_DecodeFailure(t *testing.T) {
+	vars := map[string]string{VariableContentType: ContentTypeJSON}
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			for i, body := range []string{`{"id":"1"}`, `{"id":`, `{"id":"3"}`} {
+				stream.Send(&mqv1.SubMessageResponse{
+					Topic:     req.Topic,
+					Uuid:      string(rune('1' + i)),
+					Body:      []byte(body),
+					Variables: vars,
+				})
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	decodeErrs := make(chan error, 3)
+	onDecodeError := func(msg *Message, err error) {
+		decodeErrs <- err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, errChan, err := SubscribeTyped[order](ctx, client, NewSubscribeOptions("orders"), onDecodeError)
+	if err != nil {
+		t.Fatalf("SubscribeTyped failed: %v", err)
+	}
+
+	var ids []string
+	for len(ids) < 2 {
+		select {
+		case msg := <-msgChan:
+			ids = append(ids, msg.Value.ID)
+		case err := <-errChan:
+			t.Fatalf("Expected the subscription to continue, got %v", err)
+		case <-ctx.Done():
+			t.Fatal("Timed out")
+		}
+	}
+
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+		t.Errorf("Expected orders 1 and 3, got %v", ids)
+	}
+	if len(decodeErrs) != 1 || decodeErrCode(<-decodeErrs) != ErrCodeDecode {
+		t.Error("Expected 1 decode error passed to the decode error handler")
+	}
+}
@@ -0,0 +1,165 @@
+package togomq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// VariableContentEncoding is the reserved message variable holding the compression of the body
+const VariableContentEncoding = "content-encoding"
+
+// DefaultCompressionThreshold is the body size in bytes below which messages are not compressed
+const DefaultCompressionThreshold = 1024
+
+// Compression is a body compression algorithm
+type Compression string
+
+const (
+	// CompressionNone leaves bodies uncompressed, or uses the client compression when set on a message
+	CompressionNone Compression = ""
+	// CompressionIdentity disables the client compression for a message
+	CompressionIdentity Compression = "identity"
+	// CompressionGzip compresses bodies with gzip
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd compresses bodies with Zstandard
+	CompressionZstd Compression = "zstd"
+	// CompressionSnappy compresses bodies with Snappy
+	CompressionSnappy Compression = "snappy"
+)
+
+// validate checks if the compression is supported
+func (c Compression) validate() error {
+	switch c {
+	case CompressionNone, CompressionIdentity, CompressionGzip, CompressionZstd, CompressionSnappy:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression %q", string(c))
+	}
+}
+
+// Shared zstd encoder and decoder, safe for concurrent use with EncodeAll and DecodeAll
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// initZstd creates the shared zstd encoder and decoder
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
+
+// compress compresses data with the algorithm
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		zstdOnce.Do(initZstd)
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", string(c))
+	}
+}
+
+// decompress decompresses data compressed with the algorithm
+func decompress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case CompressionZstd:
+		zstdOnce.Do(initZstd)
+		return zstdDecoder.DecodeAll(data, nil)
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", string(c))
+	}
+}
+
+// compressionFor returns the compression to apply to a message, or "" to leave it as is.
+// A compression set on the message applies regardless of the threshold.
+func (c *Client) compressionFor(msg *Message) Compression {
+	if msg.Variables[VariableContentEncoding] != "" {
+		// Already encoded by the caller
+		return ""
+	}
+	switch msg.Compression {
+	case CompressionIdentity:
+		return ""
+	case CompressionNone:
+		if len(msg.Body) < c.config.CompressionThreshold {
+			return ""
+		}
+		return c.config.Compression
+	default:
+		return msg.Compression
+	}
+}
+
+// compressPublish is the built-in publish middleware that compresses message bodies and
+// records the algorithm in the message variables. The caller's message is left untouched.
+func (c *Client) compressPublish(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		algorithm := c.compressionFor(msg)
+		if algorithm == "" || algorithm == CompressionIdentity {
+			return next.Handle(ctx, msg)
+		}
+
+		body, err := compress(algorithm, msg.Body)
+		if err != nil {
+			return NewError(ErrCodePublish, "failed to compress message body", err)
+		}
+
+		compressed := *msg
+		compressed.Body = body
+		compressed.Variables = make(map[string]string, len(msg.Variables)+1)
+		for k, v := range msg.Variables {
+			compressed.Variables[k] = v
+		}
+		compressed.Variables[VariableContentEncoding] = string(algorithm)
+		return next.Handle(ctx, &compressed)
+	})
+}
+
+// decompressConsume is the built-in consume middleware that decompresses message bodies
+// according to their content-encoding variable and removes it
+func (c *Client) decompressConsume(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		encoding := msg.Variables[VariableContentEncoding]
+		if encoding == "" || Compression(encoding) == CompressionIdentity {
+			return next.Handle(ctx, msg)
+		}
+
+		body, err := decompress(Compression(encoding), msg.Body)
+		if err != nil {
+			return NewError(ErrCodeDecode, fmt.Sprintf("failed to decompress message %s", msg.UUID), err)
+		}
+		msg.Body = body
+		delete(msg.Variables, VariableContentEncoding)
+		return next.Handle(ctx, msg)
+	})
+}
@@ -0,0 +1,144 @@
+package togomq
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+func TestCompress_RoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"id":"1","status":"created"}`, 100))
+
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionSnappy} {
+		t.Run(string(c), func(t *testing.T) {
+			compressed, err := compress(c, data)
+			if err != nil {
+				t.Fatalf("compress failed: %v", err)
+			}
+			if len(compressed) >= len(data) {
+				t.Errorf("Expected compressed size below %d, got %d", len(data), len(compressed))
+			}
+
+			decompressed, err := decompress(c, compressed)
+			if err != nil {
+				t.Fatalf("decompress failed: %v", err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Error("Round trip changed the data")
+			}
+		})
+	}
+
+	if _, err := decompress(Compression("lz4"), data); err == nil {
+		t.Error("Expected error for an unsupported compression")
+	}
+}
+
+func TestConfig_ValidateCompression(t *testing.T) {
+	if err := NewConfig(WithToken("t"), WithCompression(CompressionZstd)).Validate(); err != nil {
+		t.Errorf("Expected zstd to be valid, got %v", err)
+	}
+	if err := NewConfig(WithToken("t"), WithCompression("lz4")).Validate(); err == nil {
+		t.Error("Expected error for an unsupported compression")
+	}
+	if err := NewConfig(WithToken("t"), WithCompressionThreshold(-1)).Validate(); err == nil {
+		t.Error("Expected error for a negative threshold")
+	}
+}
+
+func TestPublish_Compression(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+	client.config.Compression = CompressionGzip
+	client.config.CompressionThreshold = 100
+
+	large := []byte(strings.Repeat("a", 1000))
+	messages := []*Message{
+		NewMessage("orders", large),
+		NewMessage("orders", []byte("small")),
+		NewMessage("orders", []byte("small")).WithCompression(CompressionZstd),
+		NewMessage("orders", large).WithCompression(CompressionIdentity),
+	}
+	if _, err := client.PubBatch(context.Background(), messages); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"gzip", "", "zstd", ""}
+	for i, req := range received {
+		if got := req.Variables[VariableContentEncoding]; got != expected[i] {
+			t.Errorf("Message %d: expected encoding %q, got %q", i, expected[i], got)
+		}
+		if expected[i] == "" {
+			continue
+		}
+		body, err := decompress(Compression(expected[i]), req.Body)
+		if err != nil || !bytes.Equal(body, messages[i].Body) {
+			t.Errorf("Message %d: body does not decompress to the original: %v", i, err)
+		}
+	}
+
+	// The caller's messages are left untouched
+	if !bytes.Equal(messages[0].Body, large) || messages[0].Variables[VariableContentEncoding] != "" {
+		t.Error("Expected the published message to be unchanged")
+	}
+}
+
+func TestSub_Decompression(t *testing.T) {
+	body := []byte(strings.Repeat("payload", 50))
+	compressed, err := compress(CompressionSnappy, body)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			encoded := map[string]string{VariableContentEncoding: "snappy", "k": "v"}
+			stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: "1", Body: []byte("corrupt"), Variables: encoded})
+			stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: "2", Body: compressed, Variables: encoded})
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+
+	var rejected []error
+	var rejectedMu sync.Mutex
+	client.config.ConsumeErrorHandler = func(msg *Message, err error) {
+		rejectedMu.Lock()
+		defer rejectedMu.Unlock()
+		rejected = append(rejected, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	msg := <-msgChan
+	if msg == nil || msg.UUID != "2" {
+		t.Fatalf("Expected message 2, got %+v", msg)
+	}
+	if !bytes.Equal(msg.Body, body) {
+		t.Error("Expected the body to be decompressed")
+	}
+	if _, ok := msg.Variables[VariableContentEncoding]; ok || msg.Variables["k"] != "v" {
+		t.Errorf("Expected only the encoding variable to be removed, got %v", msg.Variables)
+	}
+
+	rejectedMu.Lock()
+	defer rejectedMu.Unlock()
+	if len(rejected) != 1 || decodeErrCode(rejected[0]) != ErrCodeDecode {
+		t.Errorf("Expected 1 decode error for the corrupt message, got %v", rejected)
+	}
+}
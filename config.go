@@ -1,9 +1,15 @@
 package togomq
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
 )
 
 // Config holds the configuration for the TogoMQ client
@@ -12,12 +18,25 @@ type Config struct {
 	Host string
 	// Port is the TogoMQ server port
 	Port int
-	// LogLevel defines the logging verbosity
+	// Endpoints are the host:port addresses of the servers, used instead of Host and Port when set
+	Endpoints []string
+	// LoadBalancing spreads calls over the endpoints or the DNS records of Host (default: pick_first)
+	LoadBalancing LoadBalancing
+	// HealthCheck enables gRPC health checking of the servers. It requires round_robin load balancing:
+	// gRPC's pick_first stays on the connected server without checking its health.
+	HealthCheck bool
+	// LogLevel defines the logging verbosity, used when Logger is not set
 	LogLevel string
-	// Token is the authentication token (required)
+	// Logger receives the structured SDK logs (default: nil, standard library logger filtered by LogLevel)
+	Logger *slog.Logger
+	// Token is the authentication token (required unless TokenSource is set)
 	Token string
+	// TokenSource supplies expiring authentication tokens, refreshed before they expire (optional, overrides Token)
+	TokenSource TokenSource
 	// UseTLS enables TLS for the connection (default: true)
 	UseTLS bool
+	// TLS configures the CA bundle, client certificate and verification of TLS connections (default: nil, system roots)
+	TLS *TLSOptions
 	// MaxMessageSize is the maximum message size in bytes for both send and receive (default: 50MB)
 	MaxMessageSize int
 	// InitialWindowSize is the initial window size for flow control (default: 128MB)
@@ -32,6 +51,40 @@ type Config struct {
 	KeepaliveTime time.Duration
 	// KeepaliveTimeout is the duration to wait for keepalive ping response (default: 20s)
 	KeepaliveTimeout time.Duration
+	// RetryPolicy configures retries of failed calls (default: nil, no retries)
+	RetryPolicy *RetryPolicy
+	// PublishMiddleware runs on every published message, the first one is the outermost
+	PublishMiddleware []PublishMiddleware
+	// ConsumeMiddleware runs on every received message, the first one is the outermost
+	ConsumeMiddleware []ConsumeMiddleware
+	// ConsumeErrorHandler is called when a consume middleware rejects a message (optional)
+	ConsumeErrorHandler func(msg *Message, err error)
+	// TracerProvider creates the publish and receive spans (default: nil, tracing disabled)
+	TracerProvider trace.TracerProvider
+	// Propagator carries the trace context in message variables (default: W3C trace context)
+	Propagator propagation.TextMapPropagator
+	// Metrics receives the SDK measurements (default: nil, measurements are discarded)
+	Metrics Metrics
+	// Compression is the algorithm used to compress message bodies (default: none)
+	Compression Compression
+	// CompressionThreshold is the body size in bytes below which messages are not compressed (default: 1KB)
+	CompressionThreshold int
+	// Encryption enables end-to-end encryption of message bodies (default: nil, disabled)
+	Encryption *EncryptionOptions
+	// Signing enables message signing and signature verification (default: nil, disabled)
+	Signing *SigningOptions
+	// RateLimit limits the rate of all published messages (default: nil, unlimited)
+	RateLimit *RateLimitOptions
+	// TopicRateLimits limit the rate of the messages published to topic patterns;
+	// the first matching pattern applies in addition to RateLimit
+	TopicRateLimits []TopicRateLimit
+	// DialOptions are appended to the gRPC dial options built from the configuration (optional)
+	DialOptions []grpc.DialOption
+
+	// sources records where fields loaded by LoadConfig were set, for validation errors
+	sources map[string]string
+	// optionErr is the first error of an option that can fail, such as WithURL
+	optionErr error
 }
 
 // DefaultConfig returns a Config with default values
@@ -50,46 +103,129 @@ func DefaultConfig() *Config {
 		ReadBufferSize:        2 * 1024 * 1024,   // 2MB
 		KeepaliveTime:         60 * time.Second,  // 60s
 		KeepaliveTimeout:      20 * time.Second,  // 20s
+		CompressionThreshold:  DefaultCompressionThreshold,
 	}
 }
 
-// Validate checks if the configuration is valid
+// Validate checks if the configuration is valid.
+// Errors about values loaded from a file or the environment name their source.
 func (c *Config) Validate() error {
+	err := c.validate()
+	var fe *fieldError
+	if errors.As(err, &fe) && c.sources[fe.field] != "" {
+		return fmt.Errorf("%w (%s set by %s)", err, fe.field, c.sources[fe.field])
+	}
+	return err
+}
+
+// fieldError is a validation error of a Config field
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string { return e.err.Error() }
+func (e *fieldError) Unwrap() error { return e.err }
+
+// invalid returns a validation error of a Config field
+func invalid(field, message string) error {
+	return &fieldError{field: field, err: errors.New(message)}
+}
+
+// validate checks the configuration fields
+func (c *Config) validate() error {
+	if c.optionErr != nil {
+		return c.optionErr
+	}
 	if strings.TrimSpace(c.Host) == "" {
-		return fmt.Errorf("host cannot be empty")
+		return invalid("Host", "host cannot be empty")
 	}
 	if c.Port <= 0 || c.Port > 65535 {
-		return fmt.Errorf("port must be between 1 and 65535")
+		return invalid("Port", "port must be between 1 and 65535")
+	}
+	if err := validateEndpoints(c.Endpoints); err != nil {
+		return &fieldError{field: "Endpoints", err: err}
+	}
+	if err := c.LoadBalancing.validate(); err != nil {
+		return &fieldError{field: "LoadBalancing", err: err}
 	}
-	if strings.TrimSpace(c.Token) == "" {
-		return fmt.Errorf("token is required")
+	if c.HealthCheck && c.LoadBalancing != LoadBalancingRoundRobin {
+		return invalid("HealthCheck", "health checks require round_robin load balancing, pick_first ignores them")
+	}
+	if strings.TrimSpace(c.Token) == "" && c.TokenSource == nil {
+		return invalid("Token", "token is required")
 	}
 	if c.MaxMessageSize <= 0 {
-		return fmt.Errorf("max message size must be greater than 0")
+		return invalid("MaxMessageSize", "max message size must be greater than 0")
 	}
 	if c.InitialWindowSize <= 0 {
-		return fmt.Errorf("initial window size must be greater than 0")
+		return invalid("InitialWindowSize", "initial window size must be greater than 0")
 	}
 	if c.InitialConnWindowSize <= 0 {
-		return fmt.Errorf("initial connection window size must be greater than 0")
+		return invalid("InitialConnWindowSize", "initial connection window size must be greater than 0")
 	}
 	if c.WriteBufferSize <= 0 {
-		return fmt.Errorf("write buffer size must be greater than 0")
+		return invalid("WriteBufferSize", "write buffer size must be greater than 0")
 	}
 	if c.ReadBufferSize <= 0 {
-		return fmt.Errorf("read buffer size must be greater than 0")
+		return invalid("ReadBufferSize", "read buffer size must be greater than 0")
 	}
 	if c.KeepaliveTime <= 0 {
-		return fmt.Errorf("keepalive time must be greater than 0")
+		return invalid("KeepaliveTime", "keepalive time must be greater than 0")
 	}
 	if c.KeepaliveTimeout <= 0 {
-		return fmt.Errorf("keepalive timeout must be greater than 0")
+		return invalid("KeepaliveTimeout", "keepalive timeout must be greater than 0")
+	}
+	if c.TLS != nil {
+		if !c.UseTLS {
+			return invalid("UseTLS", "TLS options require TLS to be enabled")
+		}
+		if err := c.TLS.validate(); err != nil {
+			return &fieldError{field: "TLS", err: err}
+		}
+	}
+	if c.RetryPolicy != nil {
+		if err := c.RetryPolicy.validate(); err != nil {
+			return &fieldError{field: "RetryPolicy", err: err}
+		}
+	}
+	if c.Encryption != nil {
+		if err := c.Encryption.validate(); err != nil {
+			return &fieldError{field: "Encryption", err: err}
+		}
+	}
+	if c.Signing != nil {
+		if err := c.Signing.validate(); err != nil {
+			return &fieldError{field: "Signing", err: err}
+		}
+	}
+	if c.RateLimit != nil {
+		if err := c.RateLimit.validate(); err != nil {
+			return &fieldError{field: "RateLimit", err: err}
+		}
+	}
+	for _, topic := range c.TopicRateLimits {
+		if topic.Pattern == "" || topic.Limit == nil {
+			return invalid("TopicRateLimits", "topic rate limits require a pattern and a limit")
+		}
+		if err := topic.Limit.validate(); err != nil {
+			return &fieldError{field: "TopicRateLimits", err: fmt.Errorf("topic %s: %w", topic.Pattern, err)}
+		}
+	}
+	if err := c.Compression.validate(); err != nil {
+		return &fieldError{field: "Compression", err: err}
+	}
+	if c.CompressionThreshold < 0 {
+		return invalid("CompressionThreshold", "compression threshold cannot be negative")
 	}
 	return nil
 }
 
-// Address returns the full server address
+// Address returns the full server address, or the comma-separated endpoints when set
 func (c *Config) Address() string {
+	if len(c.Endpoints) > 0 {
+		return strings.Join(c.Endpoints, ",")
+	}
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
@@ -110,6 +246,27 @@ func WithPort(port int) ConfigOption {
 	}
 }
 
+// WithEndpoints sets the host:port addresses of the servers, used instead of Host and Port
+func WithEndpoints(endpoints ...string) ConfigOption {
+	return func(c *Config) {
+		c.Endpoints = endpoints
+	}
+}
+
+// WithLoadBalancing sets the policy spreading calls over the server addresses
+func WithLoadBalancing(policy LoadBalancing) ConfigOption {
+	return func(c *Config) {
+		c.LoadBalancing = policy
+	}
+}
+
+// WithHealthCheck enables gRPC health checking of the servers, with round_robin load balancing
+func WithHealthCheck(enabled bool) ConfigOption {
+	return func(c *Config) {
+		c.HealthCheck = enabled
+	}
+}
+
 // WithLogLevel sets the log level
 func WithLogLevel(level string) ConfigOption {
 	return func(c *Config) {
@@ -117,6 +274,13 @@ func WithLogLevel(level string) ConfigOption {
 	}
 }
 
+// WithLogger sets the *slog.Logger that receives the SDK logs
+func WithLogger(logger *slog.Logger) ConfigOption {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
 // WithToken sets the token
 func WithToken(token string) ConfigOption {
 	return func(c *Config) {
@@ -124,6 +288,13 @@ func WithToken(token string) ConfigOption {
 	}
 }
 
+// WithTokenSource sets the source of expiring authentication tokens
+func WithTokenSource(source TokenSource) ConfigOption {
+	return func(c *Config) {
+		c.TokenSource = source
+	}
+}
+
 // WithUseTLS sets whether to use TLS for the connection
 func WithUseTLS(useTLS bool) ConfigOption {
 	return func(c *Config) {
@@ -131,6 +302,14 @@ func WithUseTLS(useTLS bool) ConfigOption {
 	}
 }
 
+// WithTLS sets the TLS options and enables TLS
+func WithTLS(opts *TLSOptions) ConfigOption {
+	return func(c *Config) {
+		c.UseTLS = true
+		c.TLS = opts
+	}
+}
+
 // WithMaxMessageSize sets the maximum message size in bytes
 func WithMaxMessageSize(size int) ConfigOption {
 	return func(c *Config) {
@@ -183,6 +362,104 @@ func WithKeepaliveTimeout(duration time.Duration) ConfigOption {
 	}
 }
 
+// WithRetryPolicy sets the retry policy used by all calls
+func WithRetryPolicy(policy *RetryPolicy) ConfigOption {
+	return func(c *Config) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithPublishMiddleware appends middleware to the publish path
+func WithPublishMiddleware(middleware ...PublishMiddleware) ConfigOption {
+	return func(c *Config) {
+		c.PublishMiddleware = append(c.PublishMiddleware, middleware...)
+	}
+}
+
+// WithConsumeMiddleware appends middleware to the consume path
+func WithConsumeMiddleware(middleware ...ConsumeMiddleware) ConfigOption {
+	return func(c *Config) {
+		c.ConsumeMiddleware = append(c.ConsumeMiddleware, middleware...)
+	}
+}
+
+// WithConsumeErrorHandler sets the function called when a consume middleware rejects a message
+func WithConsumeErrorHandler(fn func(msg *Message, err error)) ConfigOption {
+	return func(c *Config) {
+		c.ConsumeErrorHandler = fn
+	}
+}
+
+// WithTracerProvider enables tracing with the given OpenTelemetry tracer provider
+func WithTracerProvider(provider trace.TracerProvider) ConfigOption {
+	return func(c *Config) {
+		c.TracerProvider = provider
+	}
+}
+
+// WithPropagator sets the propagator that carries the trace context in message variables
+func WithPropagator(propagator propagation.TextMapPropagator) ConfigOption {
+	return func(c *Config) {
+		c.Propagator = propagator
+	}
+}
+
+// WithMetrics sets the Metrics that receives the SDK measurements
+func WithMetrics(metrics Metrics) ConfigOption {
+	return func(c *Config) {
+		c.Metrics = metrics
+	}
+}
+
+// WithCompression sets the algorithm used to compress message bodies
+func WithCompression(compression Compression) ConfigOption {
+	return func(c *Config) {
+		c.Compression = compression
+	}
+}
+
+// WithCompressionThreshold sets the body size in bytes below which messages are not compressed
+func WithCompressionThreshold(threshold int) ConfigOption {
+	return func(c *Config) {
+		c.CompressionThreshold = threshold
+	}
+}
+
+// WithEncryption enables end-to-end encryption of message bodies
+func WithEncryption(opts *EncryptionOptions) ConfigOption {
+	return func(c *Config) {
+		c.Encryption = opts
+	}
+}
+
+// WithSigning enables message signing and signature verification
+func WithSigning(opts *SigningOptions) ConfigOption {
+	return func(c *Config) {
+		c.Signing = opts
+	}
+}
+
+// WithRateLimit sets the rate limit of all published messages
+func WithRateLimit(opts *RateLimitOptions) ConfigOption {
+	return func(c *Config) {
+		c.RateLimit = opts
+	}
+}
+
+// WithTopicRateLimit adds a rate limit shared by the topics matching the pattern
+func WithTopicRateLimit(pattern string, opts *RateLimitOptions) ConfigOption {
+	return func(c *Config) {
+		c.TopicRateLimits = append(c.TopicRateLimits, TopicRateLimit{Pattern: pattern, Limit: opts})
+	}
+}
+
+// WithDialOptions appends gRPC dial options, e.g. a custom dialer or interceptors
+func WithDialOptions(opts ...grpc.DialOption) ConfigOption {
+	return func(c *Config) {
+		c.DialOptions = append(c.DialOptions, opts...)
+	}
+}
+
 // NewConfig creates a new Config with optional overrides
 func NewConfig(opts ...ConfigOption) *Config {
 	cfg := DefaultConfig()
@@ -0,0 +1,177 @@
+package togomq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Handler processes messages delivered by a Consumer
+type Handler interface {
+	// Handle processes a single message. The context is cancelled when the
+	// shutdown deadline of the consumer is exceeded.
+	Handle(ctx context.Context, msg *Message) error
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface
+type HandlerFunc func(ctx context.Context, msg *Message) error
+
+// Handle calls f(ctx, msg)
+func (f HandlerFunc) Handle(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// ConsumerOption is a function that modifies a Consumer
+type ConsumerOption func(*Consumer)
+
+// WithWorkers sets the number of goroutines handling messages concurrently (default: 1)
+func WithWorkers(workers int) ConsumerOption {
+	return func(c *Consumer) {
+		c.workers = workers
+	}
+}
+
+// WithShutdownTimeout sets how long in-flight handlers may run after shutdown starts (default: 30s)
+func WithShutdownTimeout(timeout time.Duration) ConsumerOption {
+	return func(c *Consumer) {
+		c.shutdownTimeout = timeout
+	}
+}
+
+// WithErrorHandler sets the function called when a handler returns an error (default: log the error)
+func WithErrorHandler(fn func(msg *Message, err error)) ConsumerOption {
+	return func(c *Consumer) {
+		c.onError = fn
+	}
+}
+
+// Consumer subscribes to a topic and dispatches messages to a Handler from a pool of workers
+type Consumer struct {
+	client          *Client
+	opts            *SubscribeOptions
+	handler         Handler
+	workers         int
+	shutdownTimeout time.Duration
+	onError         func(msg *Message, err error)
+}
+
+// NewConsumer creates a Consumer for the given subscription and handler
+func NewConsumer(client *Client, opts *SubscribeOptions, handler Handler, options ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		client:          client,
+		opts:            opts,
+		handler:         handler,
+		workers:         1,
+		shutdownTimeout: 30 * time.Second,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	if c.workers < 1 {
+		c.workers = 1
+	}
+	if c.onError == nil {
+		c.onError = func(msg *Message, err error) {
+			client.logger.With(LogKeyOperation, opConsumer, LogKeyTopic, msg.Topic, LogKeyUUID, msg.UUID).
+				WithError(err).Error("Handler failed")
+		}
+	}
+	return c
+}
+
+// Run subscribes and handles messages until ctx is cancelled or the subscription fails.
+// On shutdown it stops receiving, waits for in-flight handlers up to the shutdown timeout
+// and then cancels their context. Run returns only when all handlers have returned.
+// It returns nil after a graceful shutdown, or the subscription or shutdown error.
+func (c *Consumer) Run(ctx context.Context) error {
+	log := c.client.logger.With(LogKeyOperation, opConsumer, LogKeyTopic, c.opts.Topic)
+
+	// The subscription and the handlers outlive ctx until the shutdown completes
+	subCtx, cancelSub := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSub()
+
+	msgChan, errChan, err := c.client.Sub(subCtx, c.opts)
+	if err != nil {
+		return err
+	}
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	jobs := make(chan *Message)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				if err := c.handler.Handle(handlerCtx, msg); err != nil {
+					c.onError(msg, err)
+				}
+			}
+		}()
+	}
+
+	runErr := c.dispatch(ctx, msgChan, errChan, jobs)
+
+	// Stop receiving and drain the in-flight handlers
+	cancelSub()
+	close(jobs)
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(c.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		log.Warn("Shutdown timeout of %v exceeded, cancelling in-flight handlers", c.shutdownTimeout)
+		cancelHandlers()
+		<-drained
+		if runErr == nil {
+			runErr = NewError(ErrCodeSubscribe, "shutdown timeout exceeded while draining handlers", nil)
+		}
+	}
+
+	log.Info("Consumer stopped")
+	return runErr
+}
+
+// dispatch forwards messages to the workers until ctx is done or the subscription ends
+func (c *Consumer) dispatch(ctx context.Context, msgChan <-chan *Message, errChan <-chan error, jobs chan<- *Message) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			return err
+
+		case msg, ok := <-msgChan:
+			if !ok {
+				// The error channel is closed before the message channel
+				if errChan != nil {
+					if err, ok := <-errChan; ok {
+						return err
+					}
+				}
+				return nil
+			}
+
+			select {
+			case jobs <- msg:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
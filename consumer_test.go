@@ -0,0 +1,162 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamingSubServer returns a fakeServer that sends count messages and keeps the stream open
+func streamingSubServer(count int) *fakeServer {
+	return &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			for i := 0; i < count; i++ {
+				err := stream.Send(&mqv1.SubMessageResponse{
+					Topic: req.Topic,
+					Uuid:  fmt.Sprintf("%d", i),
+					Body:  []byte("body"),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+}
+
+func TestConsumer_Run(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled atomic.Int32
+	var failed atomic.Int32
+
+	handler := HandlerFunc(func(ctx context.Context, msg *Message) error {
+		if handled.Add(1) == 10 {
+			cancel()
+		}
+		if msg.UUID == "3" {
+			return errors.New("cannot handle message 3")
+		}
+		return nil
+	})
+
+	consumer := NewConsumer(client, NewSubscribeOptions("orders"), handler,
+		WithWorkers(4),
+		WithErrorHandler(func(msg *Message, err error) {
+			failed.Add(1)
+		}),
+	)
+
+	if err := consumer.Run(ctx); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if handled.Load() != 10 {
+		t.Errorf("Expected 10 handled messages, got %d", handled.Load())
+	}
+	if failed.Load() != 1 {
+		t.Errorf("Expected 1 failed message, got %d", failed.Load())
+	}
+}
+
+func TestConsumer_Workers(t *testing.T) {
+	const workers = 3
+	client := newTestClient(t, streamingSubServer(workers))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	// Every handler waits until all workers are busy at the same time
+	handler := HandlerFunc(func(ctx context.Context, msg *Message) error {
+		wg.Done()
+		wg.Wait()
+		return nil
+	})
+
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	consumer := NewConsumer(client, NewSubscribeOptions("orders"), handler, WithWorkers(workers))
+
+	errChan := make(chan error, 1)
+	go func() { errChan <- consumer.Run(ctx) }()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected handlers to run concurrently")
+	}
+}
+
+func TestConsumer_ShutdownTimeout(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var handlerCancelled atomic.Bool
+
+	handler := HandlerFunc(func(handlerCtx context.Context, msg *Message) error {
+		cancel()
+		<-handlerCtx.Done()
+		handlerCancelled.Store(true)
+		return handlerCtx.Err()
+	})
+
+	consumer := NewConsumer(client, NewSubscribeOptions("orders"), handler,
+		WithShutdownTimeout(20*time.Millisecond),
+		WithErrorHandler(func(msg *Message, err error) {}),
+	)
+
+	err := consumer.Run(ctx)
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodeSubscribe {
+		t.Fatalf("Expected %s error, got %v", ErrCodeSubscribe, err)
+	}
+	if !handlerCancelled.Load() {
+		t.Error("Expected Run to return after the handler finished")
+	}
+}
+
+func TestConsumer_SubscriptionError(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			return status.Error(codes.Unauthenticated, "invalid token")
+		},
+	}
+	client := newTestClient(t, srv)
+
+	consumer := NewConsumer(client, NewSubscribeOptions("orders"), HandlerFunc(func(ctx context.Context, msg *Message) error {
+		return nil
+	}))
+
+	err := consumer.Run(context.Background())
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodeAuth {
+		t.Fatalf("Expected %s error, got %v", ErrCodeAuth, err)
+	}
+}
+
+func TestConsumer_Validation(t *testing.T) {
+	client := newTestClient(t, &fakeServer{})
+	consumer := NewConsumer(client, NewSubscribeOptions(""), HandlerFunc(func(ctx context.Context, msg *Message) error {
+		return nil
+	}))
+
+	err := consumer.Run(context.Background())
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodeValidation {
+		t.Fatalf("Expected %s error, got %v", ErrCodeValidation, err)
+	}
+}
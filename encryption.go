@@ -0,0 +1,268 @@
+package togomq
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Reserved message variables of encrypted messages
+const (
+	// VariableEncryptionKeyID holds the ID of the key that wraps the data key
+	VariableEncryptionKeyID = "encryption-key-id"
+	// VariableEncryptionDataKey holds the wrapped data key, base64 encoded
+	VariableEncryptionDataKey = "encryption-data-key"
+)
+
+// dataKeySize is the size of the per-message AES-256 data keys
+const dataKeySize = 32
+
+// ErrKeyNotFound is returned by a KeyProvider that does not know a key ID
+var ErrKeyNotFound = errors.New("togomq: encryption key not found")
+
+// KeyProvider supplies the key-encryption keys used for envelope encryption.
+// Keys must be 16, 24 or 32 bytes long (AES-128, AES-192 or AES-256).
+type KeyProvider interface {
+	// EncryptionKey returns the ID and the key used to encrypt new messages
+	EncryptionKey(ctx context.Context) (id string, key []byte, err error)
+	// DecryptionKey returns the key with the ID, or an error wrapping ErrKeyNotFound
+	DecryptionKey(ctx context.Context, id string) ([]byte, error)
+}
+
+// EncryptionOptions configures end-to-end encryption of message bodies
+type EncryptionOptions struct {
+	// Keys supplies the key-encryption keys (required)
+	Keys KeyProvider
+	// Topics are the topic patterns whose messages are encrypted (empty = all topics).
+	// Received messages are decrypted whatever their topic.
+	Topics []string
+}
+
+// NewEncryptionOptions creates encryption options that encrypt all topics with the keys
+func NewEncryptionOptions(keys KeyProvider) *EncryptionOptions {
+	return &EncryptionOptions{
+		Keys: keys,
+	}
+}
+
+// WithTopics restricts encryption to the topic patterns
+func (o *EncryptionOptions) WithTopics(patterns ...string) *EncryptionOptions {
+	o.Topics = patterns
+	return o
+}
+
+// validate checks if the encryption options are valid
+func (o *EncryptionOptions) validate() error {
+	if o.Keys == nil {
+		return fmt.Errorf("encryption key provider is required")
+	}
+	return nil
+}
+
+// encrypts reports whether messages published to the topic are encrypted
+func (o *EncryptionOptions) encrypts(topic string) bool {
+	if len(o.Topics) == 0 {
+		return true
+	}
+	for _, pattern := range o.Topics {
+		if MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyRing is a KeyProvider holding several keys, one of which encrypts new messages.
+// To rotate keys, add the new key, make it current, and remove the old key once no
+// message encrypted with it is left. It is safe for concurrent use.
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	current string
+}
+
+// NewKeyRing creates a key ring with a single key, which is current
+func NewKeyRing(id string, key []byte) (*KeyRing, error) {
+	r := &KeyRing{keys: make(map[string][]byte)}
+	if err := r.Add(id, key); err != nil {
+		return nil, err
+	}
+	r.current = id
+	return r, nil
+}
+
+// Add adds a key that can decrypt messages
+func (r *KeyRing) Add(id string, key []byte) error {
+	if id == "" {
+		return fmt.Errorf("key ID cannot be empty")
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("invalid key %q: %w", id, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetCurrent makes a key encrypt new messages
+func (r *KeyRing) SetCurrent(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[id]; !ok {
+		return fmt.Errorf("key %q: %w", id, ErrKeyNotFound)
+	}
+	r.current = id
+	return nil
+}
+
+// Remove removes a key that is not current
+func (r *KeyRing) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == r.current {
+		return fmt.Errorf("cannot remove the current key %q", id)
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+// EncryptionKey returns the current key
+func (r *KeyRing) EncryptionKey(ctx context.Context) (string, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current, r.keys[r.current], nil
+}
+
+// DecryptionKey returns the key with the ID
+func (r *KeyRing) DecryptionKey(ctx context.Context, id string) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", id, ErrKeyNotFound)
+	}
+	return key, nil
+}
+
+// seal encrypts plaintext with AES-GCM and returns the nonce followed by the ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts data produced by seal
+func open(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// newGCM creates an AES-GCM cipher
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptPublish is the built-in publish middleware that encrypts message bodies with a random
+// data key, wrapped by the current key of the provider. The caller's message is left untouched.
+func (c *Client) encryptPublish(next Handler) Handler {
+	opts := c.config.Encryption
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		if !opts.encrypts(msg.Topic) {
+			return next.Handle(ctx, msg)
+		}
+
+		keyID, key, err := opts.Keys.EncryptionKey(ctx)
+		if err != nil {
+			return NewError(ErrCodePublish, "failed to get encryption key", err)
+		}
+
+		dataKey := make([]byte, dataKeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return NewError(ErrCodePublish, "failed to generate data key", err)
+		}
+		// The body is bound to its topic and the data key to its key ID
+		body, err := seal(dataKey, msg.Body, []byte(msg.Topic))
+		if err != nil {
+			return NewError(ErrCodePublish, "failed to encrypt message body", err)
+		}
+		wrapped, err := seal(key, dataKey, []byte(keyID))
+		if err != nil {
+			return NewError(ErrCodePublish, fmt.Sprintf("failed to wrap data key with key %q", keyID), err)
+		}
+
+		encrypted := *msg
+		encrypted.Body = body
+		encrypted.Variables = make(map[string]string, len(msg.Variables)+2)
+		for k, v := range msg.Variables {
+			encrypted.Variables[k] = v
+		}
+		encrypted.Variables[VariableEncryptionKeyID] = keyID
+		encrypted.Variables[VariableEncryptionDataKey] = base64.StdEncoding.EncodeToString(wrapped)
+		return next.Handle(ctx, &encrypted)
+	})
+}
+
+// decryptConsume is the built-in consume middleware that decrypts encrypted message bodies
+// and removes the encryption variables
+func (c *Client) decryptConsume(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		keyID, ok := msg.Variables[VariableEncryptionKeyID]
+		if !ok {
+			return next.Handle(ctx, msg)
+		}
+
+		if c.config.Encryption == nil {
+			return NewError(ErrCodeUnknownKey,
+				fmt.Sprintf("message %s is encrypted with key %q but no key provider is configured", msg.UUID, keyID), nil)
+		}
+		key, err := c.config.Encryption.Keys.DecryptionKey(ctx, keyID)
+		if errors.Is(err, ErrKeyNotFound) {
+			return NewError(ErrCodeUnknownKey, fmt.Sprintf("message %s is encrypted with unknown key %q", msg.UUID, keyID), err)
+		}
+		if err != nil {
+			return NewError(ErrCodeDecode, fmt.Sprintf("failed to get decryption key %q", keyID), err)
+		}
+
+		wrapped, err := base64.StdEncoding.DecodeString(msg.Variables[VariableEncryptionDataKey])
+		if err != nil {
+			return NewError(ErrCodeDecode, fmt.Sprintf("invalid data key in message %s", msg.UUID), err)
+		}
+		dataKey, err := open(key, wrapped, []byte(keyID))
+		if err != nil {
+			return NewError(ErrCodeDecode, fmt.Sprintf("failed to unwrap data key of message %s", msg.UUID), err)
+		}
+		body, err := open(dataKey, msg.Body, []byte(msg.Topic))
+		if err != nil {
+			return NewError(ErrCodeDecode, fmt.Sprintf("failed to decrypt message %s", msg.UUID), err)
+		}
+
+		msg.Body = body
+		delete(msg.Variables, VariableEncryptionKeyID)
+		delete(msg.Variables, VariableEncryptionDataKey)
+		return next.Handle(ctx, msg)
+	})
+}
@@ -0,0 +1,271 @@
+package togomq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 32)
+)
+
+// publishRequests publishes the messages with the client options and returns the requests
+// received by the server
+func publishRequests(t *testing.T, configure func(*Config), messages ...*Message) []*mqv1.PubMessageRequest {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+	configure(client.config)
+
+	if _, err := client.PubBatch(context.Background(), messages); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return received
+}
+
+// replaySubscribe delivers the requests as received messages to a client configured with
+// configure and returns the delivered messages and the rejection errors
+func replaySubscribe(t *testing.T, configure func(*Config), requests []*mqv1.PubMessageRequest) ([]*Message, []error) {
+	t.Helper()
+
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			for i, r := range requests {
+				stream.Send(&mqv1.SubMessageResponse{
+					Topic:     r.Topic,
+					Uuid:      string(rune('0' + i)),
+					Body:      r.Body,
+					Variables: r.Variables,
+				})
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	configure(client.config)
+
+	var mu sync.Mutex
+	var rejected []error
+	client.config.ConsumeErrorHandler = func(msg *Message, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		rejected = append(rejected, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("*"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	var delivered []*Message
+	for {
+		mu.Lock()
+		done := len(delivered)+len(rejected) == len(requests)
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case msg := <-msgChan:
+			delivered = append(delivered, msg)
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for messages")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return delivered, rejected
+}
+
+func TestKeyRing(t *testing.T) {
+	if _, err := NewKeyRing("k1", []byte("short")); err == nil {
+		t.Error("Expected error for an invalid key size")
+	}
+
+	ring, err := NewKeyRing("k1", testKey1)
+	if err != nil {
+		t.Fatalf("NewKeyRing failed: %v", err)
+	}
+	if err := ring.SetCurrent("k2"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if err := ring.Add("k2", testKey2); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := ring.SetCurrent("k2"); err != nil {
+		t.Fatalf("SetCurrent failed: %v", err)
+	}
+	if id, key, _ := ring.EncryptionKey(context.Background()); id != "k2" || !bytes.Equal(key, testKey2) {
+		t.Errorf("Expected k2 to be current, got %s", id)
+	}
+	if err := ring.Remove("k2"); err == nil {
+		t.Error("Expected error when removing the current key")
+	}
+	if err := ring.Remove("k1"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := ring.DecryptionKey(context.Background(), "k1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a removed key, got %v", err)
+	}
+}
+
+func TestEncryption_RoundTripWithRotation(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey1)
+	encrypt := func(c *Config) { c.Encryption = NewEncryptionOptions(ring) }
+
+	secret := []byte("ssn=123-45-6789")
+	first := publishRequests(t, encrypt, NewMessage("users", secret).WithVariables(map[string]string{"k": "v"}))
+
+	// Rotate: new messages use k2, k1 still decrypts older ones
+	ring.Add("k2", testKey2)
+	ring.SetCurrent("k2")
+	second := publishRequests(t, encrypt, NewMessage("users", secret))
+
+	requests := append(first, second...)
+	for i, req := range requests {
+		if bytes.Contains(req.Body, secret) {
+			t.Errorf("Message %d: body is readable by the server", i)
+		}
+		if req.Variables[VariableEncryptionDataKey] == "" {
+			t.Errorf("Message %d: expected a wrapped data key", i)
+		}
+	}
+	if requests[0].Variables[VariableEncryptionKeyID] != "k1" || requests[1].Variables[VariableEncryptionKeyID] != "k2" {
+		t.Errorf("Expected key IDs k1 and k2, got %v and %v", requests[0].Variables, requests[1].Variables)
+	}
+
+	delivered, rejected := replaySubscribe(t, encrypt, requests)
+	if len(rejected) != 0 {
+		t.Fatalf("Unexpected rejections: %v", rejected)
+	}
+	for _, msg := range delivered {
+		if !bytes.Equal(msg.Body, secret) {
+			t.Errorf("Message %s: expected decrypted body, got %q", msg.UUID, msg.Body)
+		}
+		if _, ok := msg.Variables[VariableEncryptionKeyID]; ok {
+			t.Errorf("Message %s: expected the encryption variables to be removed", msg.UUID)
+		}
+	}
+	if delivered[0].Variables["k"] != "v" {
+		t.Errorf("Expected user variables to be kept, got %v", delivered[0].Variables)
+	}
+}
+
+func TestEncryption_PresetKeyIDIsEncrypted(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey1)
+	encrypt := func(c *Config) { c.Encryption = NewEncryptionOptions(ring) }
+
+	secret := []byte("ssn=123-45-6789")
+	msg := NewMessage("users", secret).WithVariables(map[string]string{VariableEncryptionKeyID: "forged"})
+	requests := publishRequests(t, encrypt, msg)
+
+	if bytes.Contains(requests[0].Body, secret) {
+		t.Error("Expected a message with a preset key ID variable to be encrypted")
+	}
+	if requests[0].Variables[VariableEncryptionKeyID] != "k1" || requests[0].Variables[VariableEncryptionDataKey] == "" {
+		t.Errorf("Expected the key ID and data key of the client, got %v", requests[0].Variables)
+	}
+	if msg.Variables[VariableEncryptionKeyID] != "forged" {
+		t.Error("Expected the caller's message to be left untouched")
+	}
+
+	delivered, rejected := replaySubscribe(t, encrypt, requests)
+	if len(rejected) != 0 || len(delivered) != 1 || !bytes.Equal(delivered[0].Body, secret) {
+		t.Errorf("Expected the decrypted body, got %v %v", delivered, rejected)
+	}
+}
+
+func TestEncryption_UnknownKey(t *testing.T) {
+	ring1, _ := NewKeyRing("k1", testKey1)
+	ring2, _ := NewKeyRing("k2", testKey2)
+
+	requests := publishRequests(t, func(c *Config) { c.Encryption = NewEncryptionOptions(ring1) },
+		NewMessage("users", []byte("secret")))
+
+	for name, configure := range map[string]func(*Config){
+		"unknown key ID":  func(c *Config) { c.Encryption = NewEncryptionOptions(ring2) },
+		"no key provider": func(c *Config) {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			delivered, rejected := replaySubscribe(t, configure, requests)
+			if len(delivered) != 0 {
+				t.Errorf("Expected no delivered message, got %d", len(delivered))
+			}
+			if len(rejected) != 1 || decodeErrCode(rejected[0]) != ErrCodeUnknownKey {
+				t.Errorf("Expected an unknown key error, got %v", rejected)
+			}
+		})
+	}
+}
+
+func TestEncryption_TamperedMessage(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey1)
+	encrypt := func(c *Config) { c.Encryption = NewEncryptionOptions(ring) }
+
+	requests := publishRequests(t, encrypt, NewMessage("users", []byte("secret")))
+	// The body is bound to its topic
+	requests[0].Topic = "public"
+
+	_, rejected := replaySubscribe(t, encrypt, requests)
+	if len(rejected) != 1 || decodeErrCode(rejected[0]) != ErrCodeDecode {
+		t.Errorf("Expected a decode error, got %v", rejected)
+	}
+}
+
+func TestEncryption_TopicsAndCompression(t *testing.T) {
+	ring, _ := NewKeyRing("k1", testKey1)
+	configure := func(c *Config) {
+		c.Encryption = NewEncryptionOptions(ring).WithTopics("pii.*")
+		c.Compression = CompressionGzip
+		c.CompressionThreshold = 0
+	}
+
+	body := []byte(strings.Repeat("name=alice;", 100))
+	requests := publishRequests(t, configure, NewMessage("pii.users", body), NewMessage("orders", body))
+
+	if requests[0].Variables[VariableEncryptionKeyID] != "k1" {
+		t.Error("Expected pii.users to be encrypted")
+	}
+	if _, ok := requests[1].Variables[VariableEncryptionKeyID]; ok {
+		t.Error("Expected orders not to be encrypted")
+	}
+	// Bodies are compressed before being encrypted
+	if len(requests[0].Body) >= len(body) {
+		t.Errorf("Expected the encrypted body to be compressed, got %d bytes", len(requests[0].Body))
+	}
+
+	delivered, rejected := replaySubscribe(t, configure, requests)
+	if len(rejected) != 0 {
+		t.Fatalf("Unexpected rejections: %v", rejected)
+	}
+	for _, msg := range delivered {
+		if !bytes.Equal(msg.Body, body) {
+			t.Errorf("Message %s: body does not match the original", msg.Topic)
+		}
+	}
+}
+
+func TestConfig_ValidateEncryption(t *testing.T) {
+	if err := NewConfig(WithToken("t"), WithEncryption(&EncryptionOptions{})).Validate(); err == nil {
+		t.Error("Expected error without a key provider")
+	}
+}
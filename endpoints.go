@@ -0,0 +1,162 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/health" // registers the client-side health checking
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/stats"
+)
+
+// LoadBalancing is the policy spreading calls over the server addresses
+type LoadBalancing string
+
+const (
+	// LoadBalancingPickFirst sends all calls to the first reachable address and fails over to the next ones
+	LoadBalancingPickFirst LoadBalancing = "pick_first"
+	// LoadBalancingRoundRobin spreads calls over all reachable addresses
+	LoadBalancingRoundRobin LoadBalancing = "round_robin"
+)
+
+// endpointsScheme is the resolver scheme of the Endpoints list
+const endpointsScheme = "togomq"
+
+// validate checks if the load balancing policy is supported
+func (lb LoadBalancing) validate() error {
+	switch lb {
+	case "", LoadBalancingPickFirst, LoadBalancingRoundRobin:
+		return nil
+	default:
+		return fmt.Errorf("unsupported load balancing policy %q", string(lb))
+	}
+}
+
+// validateEndpoints checks that the endpoints are host:port addresses
+func validateEndpoints(endpoints []string) error {
+	for _, endpoint := range endpoints {
+		host, port, err := net.SplitHostPort(endpoint)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("invalid endpoint %q, expected host:port", endpoint)
+		}
+	}
+	return nil
+}
+
+// serviceConfig returns the gRPC service config selecting the balancing policy and health checks
+func (c *Config) serviceConfig() string {
+	policy := c.LoadBalancing
+	if policy == "" {
+		policy = LoadBalancingPickFirst
+	}
+	config := fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]`, policy)
+	if c.HealthCheck {
+		config += `,"healthCheckConfig":{"serviceName":""}`
+	}
+	return config + "}"
+}
+
+// target returns the gRPC target and dial options resolving the server addresses.
+// Endpoints are served by a manual resolver, otherwise Host is resolved by DNS so that
+// all its records are balanced.
+func (c *Config) target() (string, []grpc.DialOption) {
+	opts := []grpc.DialOption{grpc.WithDefaultServiceConfig(c.serviceConfig())}
+	if len(c.Endpoints) == 0 {
+		return c.Address(), opts
+	}
+
+	addresses := make([]resolver.Address, len(c.Endpoints))
+	for i, endpoint := range c.Endpoints {
+		host, _, _ := net.SplitHostPort(endpoint)
+		// Certificates are verified against the host of every endpoint
+		addresses[i] = resolver.Address{Addr: endpoint, ServerName: host}
+	}
+	r := manual.NewBuilderWithScheme(endpointsScheme)
+	r.InitialState(resolver.State{Addresses: addresses})
+	// The first endpoint is the default authority of the calls
+	return endpointsScheme + ":///" + c.Endpoints[0], append(opts, grpc.WithResolvers(r))
+}
+
+// endpointTracker is a gRPC stats handler recording the connected servers and the server of the last call
+type endpointTracker struct {
+	addr atomic.Value
+
+	mu    sync.Mutex
+	conns map[string]int // number of open connections by server address
+}
+
+// connAddrKey is the context key of the server address of a connection
+type connAddrKey struct{}
+
+// TagRPC implements stats.Handler
+func (t *endpointTracker) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC records the server address when the call headers are sent
+func (t *endpointTracker) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if header, ok := s.(*stats.OutHeader); ok && header.Client && header.RemoteAddr != nil {
+		t.addr.Store(header.RemoteAddr.String())
+	}
+}
+
+// TagConn attaches the server address to the context of the connection
+func (t *endpointTracker) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	if info.RemoteAddr == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, connAddrKey{}, info.RemoteAddr.String())
+}
+
+// HandleConn counts the open connections of every server
+func (t *endpointTracker) HandleConn(ctx context.Context, s stats.ConnStats) {
+	addr, ok := ctx.Value(connAddrKey{}).(string)
+	if !ok || !s.IsClient() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch s.(type) {
+	case *stats.ConnBegin:
+		if t.conns == nil {
+			t.conns = make(map[string]int)
+		}
+		t.conns[addr]++
+	case *stats.ConnEnd:
+		if t.conns[addr]--; t.conns[addr] <= 0 {
+			delete(t.conns, addr)
+		}
+	}
+}
+
+// LastEndpoint returns the network address of the server that handled the last call,
+// or "" before the first call. With round_robin, the next call may go to another server.
+func (c *Client) LastEndpoint() string {
+	if c.endpoints == nil {
+		return ""
+	}
+	addr, _ := c.endpoints.addr.Load().(string)
+	return addr
+}
+
+// ConnectedEndpoints returns the sorted network addresses of the servers the client is connected to.
+// With pick_first it is the server receiving the calls, with round_robin all reachable servers.
+func (c *Client) ConnectedEndpoints() []string {
+	if c.endpoints == nil {
+		return nil
+	}
+	c.endpoints.mu.Lock()
+	defer c.endpoints.mu.Unlock()
+	endpoints := make([]string, 0, len(c.endpoints.conns))
+	for addr := range c.endpoints.conns {
+		endpoints = append(endpoints, addr)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
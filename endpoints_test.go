@@ -0,0 +1,162 @@
+package togomq
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc"
+)
+
+// startEndpoint serves a fake server counting its calls on a local TCP port and returns its address
+func startEndpoint(t *testing.T, calls *atomic.Int32) (string, *grpc.Server) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := grpc.NewServer()
+	mqv1.RegisterMqServiceServer(s, &fakeServer{
+		countFunc: func(ctx context.Context, _ int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			calls.Add(1)
+			return &mqv1.CountMessagesResponse{MessagesCount: 1}, nil
+		},
+	})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String(), s
+}
+
+// newEndpointsClient creates a client for the endpoints without TLS
+func newEndpointsClient(t *testing.T, opts ...ConfigOption) *Client {
+	t.Helper()
+	opts = append([]ConfigOption{WithToken("test-token"), WithUseTLS(false), WithLogLevel("none")}, opts...)
+	client, err := NewClient(NewConfig(opts...))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestEndpoints_Failover(t *testing.T) {
+	var firstCalls, secondCalls atomic.Int32
+	first, firstServer := startEndpoint(t, &firstCalls)
+	second, _ := startEndpoint(t, &secondCalls)
+
+	client := newEndpointsClient(t, WithEndpoints(first, second))
+	if client.LastEndpoint() != "" {
+		t.Errorf("Expected no endpoint before the first call, got %s", client.LastEndpoint())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.CountMessages(ctx, "orders"); err != nil {
+		t.Fatalf("CountMessages failed: %v", err)
+	}
+	if client.LastEndpoint() != first || firstCalls.Load() != 1 {
+		t.Errorf("Expected pick_first to use %s, got %s", first, client.LastEndpoint())
+	}
+
+	// Calls move to the second endpoint when the first one goes away
+	firstServer.Stop()
+	for client.LastEndpoint() != second {
+		if ctx.Err() != nil {
+			t.Fatalf("Timed out waiting for the failover, endpoint %s", client.LastEndpoint())
+		}
+		client.CountMessages(ctx, "orders")
+		time.Sleep(10 * time.Millisecond)
+	}
+	if secondCalls.Load() == 0 {
+		t.Error("Expected the second endpoint to serve calls")
+	}
+	for connected := client.ConnectedEndpoints(); len(connected) != 1 || connected[0] != second; connected = client.ConnectedEndpoints() {
+		if ctx.Err() != nil {
+			t.Fatalf("Expected to be connected to %s only, got %v", second, connected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEndpoints_RoundRobin(t *testing.T) {
+	var firstCalls, secondCalls atomic.Int32
+	first, _ := startEndpoint(t, &firstCalls)
+	second, _ := startEndpoint(t, &secondCalls)
+
+	client := newEndpointsClient(t, WithEndpoints(first, second), WithLoadBalancing(LoadBalancingRoundRobin))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		if ctx.Err() != nil {
+			t.Fatalf("Timed out waiting for both endpoints, used %v", seen)
+		}
+		if _, err := client.CountMessages(ctx, "orders"); err != nil {
+			t.Fatalf("CountMessages failed: %v", err)
+		}
+		seen[client.LastEndpoint()] = true
+	}
+	if !seen[first] || !seen[second] {
+		t.Errorf("Expected calls on %s and %s, got %v", first, second, seen)
+	}
+	if connected := client.ConnectedEndpoints(); len(connected) != 2 {
+		t.Errorf("Expected connections to both endpoints, got %v", connected)
+	}
+}
+
+func TestConfig_ValidateEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ConfigOption
+		want string
+	}{
+		{"missing port", []ConfigOption{WithEndpoints("a.internal:5123", "b.internal")}, "invalid endpoint \"b.internal\""},
+		{"unknown policy", []ConfigOption{WithLoadBalancing("random")}, "unsupported load balancing policy"},
+		{"health check", []ConfigOption{WithHealthCheck(true)}, "round_robin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewConfig(append(tt.opts, WithToken("t"))...).Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	cfg := NewConfig(WithToken("t"), WithEndpoints("a.internal:5123", "[::1]:5123"),
+		WithLoadBalancing(LoadBalancingRoundRobin), WithHealthCheck(true))
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid endpoints, got %v", err)
+	}
+	if cfg.Address() != "a.internal:5123,[::1]:5123" {
+		t.Errorf("Unexpected address %s", cfg.Address())
+	}
+}
+
+func TestConfigFromFile_Endpoints(t *testing.T) {
+	path := writeConfigFile(t, "togomq.yaml", "token: t\nendpoints:\n  - a.internal:5123\n  - b.internal:5123\nload_balancing: round_robin\n")
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("ConfigFromFile failed: %v", err)
+	}
+	if len(cfg.Endpoints) != 2 || cfg.Endpoints[1] != "b.internal:5123" || cfg.LoadBalancing != LoadBalancingRoundRobin {
+		t.Errorf("Unexpected endpoints: %v %s", cfg.Endpoints, cfg.LoadBalancing)
+	}
+
+	t.Setenv("TOGOMQ_ENDPOINTS", "c.internal:5123, d.internal:5123")
+	cfg, err = ConfigFromEnv("")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if len(cfg.Endpoints) != 2 || cfg.Endpoints[1] != "d.internal:5123" {
+		t.Errorf("Unexpected endpoints: %v", cfg.Endpoints)
+	}
+	if !strings.Contains(cfg.String(), "endpoints=c.internal%3A5123%2Cd.internal%3A5123") {
+		t.Errorf("Expected the endpoints in %s", cfg.String())
+	}
+}
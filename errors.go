@@ -1,28 +1,138 @@
 package togomq
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// Error codes
+// ErrorCode identifies the kind of a TogoMQError
+type ErrorCode string
+
+// Error codes of the SDK
 const (
-	ErrCodeConnection    = "CONNECTION_ERROR"
-	ErrCodeAuth          = "AUTH_ERROR"
-	ErrCodeValidation    = "VALIDATION_ERROR"
-	ErrCodePublish       = "PUBLISH_ERROR"
-	ErrCodeSubscribe     = "SUBSCRIBE_ERROR"
-	ErrCodeStream        = "STREAM_ERROR"
-	ErrCodeConfiguration = "CONFIG_ERROR"
+	ErrCodeConnection    ErrorCode = "CONNECTION_ERROR"
+	ErrCodeAuth          ErrorCode = "AUTH_ERROR"
+	ErrCodeValidation    ErrorCode = "VALIDATION_ERROR"
+	ErrCodePublish       ErrorCode = "PUBLISH_ERROR"
+	ErrCodeSubscribe     ErrorCode = "SUBSCRIBE_ERROR"
+	ErrCodeStream        ErrorCode = "STREAM_ERROR"
+	ErrCodeConfiguration ErrorCode = "CONFIG_ERROR"
+	ErrCodeDecode        ErrorCode = "DECODE_ERROR"
+	ErrCodeUnknownKey    ErrorCode = "UNKNOWN_KEY_ERROR"
+	ErrCodeSignature     ErrorCode = "SIGNATURE_ERROR"
+	ErrCodeRateLimit     ErrorCode = "RATE_LIMIT_ERROR"
+)
+
+// Error codes of the gRPC status codes without an SDK equivalent
+const (
+	ErrCodeCanceled           ErrorCode = "CANCELED"
+	ErrCodeUnknown            ErrorCode = "UNKNOWN"
+	ErrCodeDeadlineExceeded   ErrorCode = "DEADLINE_EXCEEDED"
+	ErrCodeNotFound           ErrorCode = "NOT_FOUND"
+	ErrCodeAlreadyExists      ErrorCode = "ALREADY_EXISTS"
+	ErrCodePermissionDenied   ErrorCode = "PERMISSION_DENIED"
+	ErrCodeResourceExhausted  ErrorCode = "RESOURCE_EXHAUSTED"
+	ErrCodeFailedPrecondition ErrorCode = "FAILED_PRECONDITION"
+	ErrCodeAborted            ErrorCode = "ABORTED"
+	ErrCodeOutOfRange         ErrorCode = "OUT_OF_RANGE"
+	ErrCodeUnimplemented      ErrorCode = "UNIMPLEMENTED"
+	ErrCodeInternal           ErrorCode = "INTERNAL"
+	ErrCodeDataLoss           ErrorCode = "DATA_LOSS"
+)
+
+// Sentinel errors matching the TogoMQErrors of a code with errors.Is,
+// e.g. errors.Is(err, togomq.ErrResourceExhausted)
+var (
+	ErrConnection         = errors.New("togomq: connection error")
+	ErrAuth               = errors.New("togomq: authentication error")
+	ErrValidation         = errors.New("togomq: validation error")
+	ErrPublish            = errors.New("togomq: publish error")
+	ErrSubscribe          = errors.New("togomq: subscribe error")
+	ErrStream             = errors.New("togomq: stream error")
+	ErrConfiguration      = errors.New("togomq: configuration error")
+	ErrDecode             = errors.New("togomq: decode error")
+	ErrUnknownKey         = errors.New("togomq: unknown key")
+	ErrSignature          = errors.New("togomq: signature error")
+	ErrRateLimit          = errors.New("togomq: rate limit exceeded")
+	ErrCanceled           = errors.New("togomq: canceled")
+	ErrUnknown            = errors.New("togomq: unknown error")
+	ErrDeadlineExceeded   = errors.New("togomq: deadline exceeded")
+	ErrNotFound           = errors.New("togomq: not found")
+	ErrAlreadyExists      = errors.New("togomq: already exists")
+	ErrPermissionDenied   = errors.New("togomq: permission denied")
+	ErrResourceExhausted  = errors.New("togomq: resource exhausted")
+	ErrFailedPrecondition = errors.New("togomq: failed precondition")
+	ErrAborted            = errors.New("togomq: aborted")
+	ErrOutOfRange         = errors.New("togomq: out of range")
+	ErrUnimplemented      = errors.New("togomq: unimplemented")
+	ErrInternal           = errors.New("togomq: internal error")
+	ErrDataLoss           = errors.New("togomq: data loss")
 )
 
+// sentinels maps the error codes to their sentinel errors
+var sentinels = map[ErrorCode]error{
+	ErrCodeConnection:         ErrConnection,
+	ErrCodeAuth:               ErrAuth,
+	ErrCodeValidation:         ErrValidation,
+	ErrCodePublish:            ErrPublish,
+	ErrCodeSubscribe:          ErrSubscribe,
+	ErrCodeStream:             ErrStream,
+	ErrCodeConfiguration:      ErrConfiguration,
+	ErrCodeDecode:             ErrDecode,
+	ErrCodeUnknownKey:         ErrUnknownKey,
+	ErrCodeSignature:          ErrSignature,
+	ErrCodeRateLimit:          ErrRateLimit,
+	ErrCodeCanceled:           ErrCanceled,
+	ErrCodeUnknown:            ErrUnknown,
+	ErrCodeDeadlineExceeded:   ErrDeadlineExceeded,
+	ErrCodeNotFound:           ErrNotFound,
+	ErrCodeAlreadyExists:      ErrAlreadyExists,
+	ErrCodePermissionDenied:   ErrPermissionDenied,
+	ErrCodeResourceExhausted:  ErrResourceExhausted,
+	ErrCodeFailedPrecondition: ErrFailedPrecondition,
+	ErrCodeAborted:            ErrAborted,
+	ErrCodeOutOfRange:         ErrOutOfRange,
+	ErrCodeUnimplemented:      ErrUnimplemented,
+	ErrCodeInternal:           ErrInternal,
+	ErrCodeDataLoss:           ErrDataLoss,
+}
+
+// grpcErrorCodes maps the gRPC status codes to error codes
+var grpcErrorCodes = map[codes.Code]ErrorCode{
+	codes.Canceled:           ErrCodeCanceled,
+	codes.Unknown:            ErrCodeUnknown,
+	codes.InvalidArgument:    ErrCodeValidation,
+	codes.DeadlineExceeded:   ErrCodeDeadlineExceeded,
+	codes.NotFound:           ErrCodeNotFound,
+	codes.AlreadyExists:      ErrCodeAlreadyExists,
+	codes.PermissionDenied:   ErrCodePermissionDenied,
+	codes.ResourceExhausted:  ErrCodeResourceExhausted,
+	codes.FailedPrecondition: ErrCodeFailedPrecondition,
+	codes.Aborted:            ErrCodeAborted,
+	codes.OutOfRange:         ErrCodeOutOfRange,
+	codes.Unimplemented:      ErrCodeUnimplemented,
+	codes.Internal:           ErrCodeInternal,
+	codes.Unavailable:        ErrCodeConnection,
+	codes.DataLoss:           ErrCodeDataLoss,
+	codes.Unauthenticated:    ErrCodeAuth,
+}
+
 // TogoMQError represents an error from the TogoMQ SDK
 type TogoMQError struct {
-	Code    string
+	Code    ErrorCode
 	Message string
 	Err     error
+	// Retries is the number of retries made before the error was returned
+	Retries int
+	// Status is the gRPC status of a server error, with its details such as RetryInfo or QuotaFailure
+	Status *status.Status
 }
 
 // Error implements the error interface
@@ -38,8 +148,80 @@ func (e *TogoMQError) Unwrap() error {
 	return e.Err
 }
 
+// Is reports whether target is the sentinel error of the code.
+// Canceled and deadline errors also match context.Canceled and context.DeadlineExceeded.
+func (e *TogoMQError) Is(target error) bool {
+	switch {
+	case sentinels[e.Code] == target:
+		return true
+	case e.Code == ErrCodeCanceled:
+		return target == context.Canceled
+	case e.Code == ErrCodeDeadlineExceeded:
+		return target == context.DeadlineExceeded
+	default:
+		return false
+	}
+}
+
+// retryableErrCodes are the codes of the errors that may succeed when the call is repeated.
+// They are also the codes retried by DefaultRetryPolicy.
+var retryableErrCodes = []ErrorCode{
+	ErrCodeConnection,
+	ErrCodeResourceExhausted,
+	ErrCodeAborted,
+}
+
+// IsRetryable reports whether the call failed without being processed and may succeed when repeated,
+// e.g. because the server is unavailable or overloaded.
+// Client rate limit errors are not retryable: RateLimitFailFast asks to fail instead of waiting.
+func (e *TogoMQError) IsRetryable() bool {
+	return slices.Contains(retryableErrCodes, e.Code)
+}
+
+// IsTemporary reports whether the error is caused by a transient condition.
+// Besides the retryable errors, it includes client rate limits, and timeouts and broken streams
+// after which the call may or may not have been processed.
+func (e *TogoMQError) IsTemporary() bool {
+	switch e.Code {
+	case ErrCodeDeadlineExceeded, ErrCodeStream, ErrCodeRateLimit:
+		return true
+	default:
+		return e.IsRetryable()
+	}
+}
+
+// Details returns the details of the gRPC status, or nil for errors without status
+func (e *TogoMQError) Details() []any {
+	if e.Status == nil {
+		return nil
+	}
+	return e.Status.Details()
+}
+
+// RetryDelay returns the delay requested by the server in a RetryInfo detail
+func (e *TogoMQError) RetryDelay() (time.Duration, bool) {
+	for _, detail := range e.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// IsRetryable reports whether err is a TogoMQError that may succeed when the call is repeated
+func IsRetryable(err error) bool {
+	var tmqErr *TogoMQError
+	return errors.As(err, &tmqErr) && tmqErr.IsRetryable()
+}
+
+// IsTemporary reports whether err is a TogoMQError caused by a transient condition
+func IsTemporary(err error) bool {
+	var tmqErr *TogoMQError
+	return errors.As(err, &tmqErr) && tmqErr.IsTemporary()
+}
+
 // NewError creates a new TogoMQError
-func NewError(code, message string, err error) *TogoMQError {
+func NewError(code ErrorCode, message string, err error) *TogoMQError {
 	return &TogoMQError{
 		Code:    code,
 		Message: message,
@@ -47,7 +229,8 @@ func NewError(code, message string, err error) *TogoMQError {
 	}
 }
 
-// WrapGRPCError wraps a gRPC error with context
+// WrapGRPCError wraps a gRPC error with context.
+// The code follows the gRPC status code and the status is kept with its details.
 func WrapGRPCError(err error, context string) error {
 	if err == nil {
 		return nil
@@ -55,20 +238,27 @@ func WrapGRPCError(err error, context string) error {
 
 	st, ok := status.FromError(err)
 	if !ok {
-		return NewError(ErrCodeStream, context, err)
+		return NewError(contextErrorCode(err), context, err)
 	}
 
-	var code string
-	switch st.Code() {
-	case codes.Unauthenticated:
-		code = ErrCodeAuth
-	case codes.InvalidArgument:
-		code = ErrCodeValidation
-	case codes.Unavailable:
-		code = ErrCodeConnection
-	default:
+	code, ok := grpcErrorCodes[st.Code()]
+	if !ok {
 		code = ErrCodeStream
 	}
 
-	return NewError(code, fmt.Sprintf("%s: %s", context, st.Message()), err)
+	wrapped := NewError(code, fmt.Sprintf("%s: %s", context, st.Message()), err)
+	wrapped.Status = st
+	return wrapped
+}
+
+// contextErrorCode returns the code of an error without gRPC status
+func contextErrorCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrCodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrCodeDeadlineExceeded
+	default:
+		return ErrCodeStream
+	}
 }
@@ -1,11 +1,16 @@
 package togomq
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func TestNewError(t *testing.T) {
@@ -78,7 +83,7 @@ func TestWrapGRPCError(t *testing.T) {
 		err          error
 		context      string
 		expectedNil  bool
-		expectedCode string
+		expectedCode ErrorCode
 	}{
 		{
 			name:        "nil error",
@@ -108,11 +113,32 @@ func TestWrapGRPCError(t *testing.T) {
 			expectedCode: ErrCodeConnection,
 		},
 		{
-			name:         "other gRPC error",
+			name:         "internal error",
 			err:          status.Error(codes.Internal, "internal error"),
 			context:      "stream error",
 			expectedNil:  false,
-			expectedCode: ErrCodeStream,
+			expectedCode: ErrCodeInternal,
+		},
+		{
+			name:         "resource exhausted error",
+			err:          status.Error(codes.ResourceExhausted, "quota exceeded"),
+			context:      "publish failed",
+			expectedNil:  false,
+			expectedCode: ErrCodeResourceExhausted,
+		},
+		{
+			name:         "deadline exceeded error",
+			err:          status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			context:      "count failed",
+			expectedNil:  false,
+			expectedCode: ErrCodeDeadlineExceeded,
+		},
+		{
+			name:         "canceled context",
+			err:          context.Canceled,
+			context:      "subscribe failed",
+			expectedNil:  false,
+			expectedCode: ErrCodeCanceled,
 		},
 		{
 			name:         "non-gRPC error",
@@ -151,3 +177,101 @@ func TestWrapGRPCError(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapGRPCError_AllCodes(t *testing.T) {
+	for code := codes.Canceled; code <= codes.Unauthenticated; code++ {
+		err := WrapGRPCError(status.Error(code, "failed"), "call failed")
+		var tmqErr *TogoMQError
+		if !errors.As(err, &tmqErr) {
+			t.Fatalf("Expected TogoMQError for %s, got %T", code, err)
+		}
+		if tmqErr.Code == ErrCodeStream {
+			t.Errorf("Expected a dedicated error code for %s", code)
+		}
+		if !errors.Is(err, sentinels[tmqErr.Code]) {
+			t.Errorf("Expected %s to match its sentinel error", code)
+		}
+		if tmqErr.Status == nil || tmqErr.Status.Code() != code {
+			t.Errorf("Expected the %s status to be kept, got %v", code, tmqErr.Status)
+		}
+	}
+}
+
+func TestTogoMQError_Is(t *testing.T) {
+	err := fmt.Errorf("publishing: %w", WrapGRPCError(status.Error(codes.PermissionDenied, "topic is read-only"), "publish failed"))
+
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Error("Expected the error to match ErrPermissionDenied")
+	}
+	if errors.Is(err, ErrAuth) || errors.Is(err, ErrSkipMessage) {
+		t.Error("Expected the error not to match other sentinel errors")
+	}
+	if !errors.Is(NewError(ErrCodeValidation, "topic is required", nil), ErrValidation) {
+		t.Error("Expected SDK errors to match their sentinel error")
+	}
+
+	deadline := WrapGRPCError(status.Error(codes.DeadlineExceeded, "deadline exceeded"), "count failed")
+	if !errors.Is(deadline, context.DeadlineExceeded) || !errors.Is(deadline, ErrDeadlineExceeded) {
+		t.Error("Expected a deadline error to match context.DeadlineExceeded")
+	}
+	if !errors.Is(WrapGRPCError(status.Error(codes.Canceled, "canceled"), "sub failed"), context.Canceled) {
+		t.Error("Expected a canceled error to match context.Canceled")
+	}
+}
+
+func TestTogoMQError_IsRetryable(t *testing.T) {
+	tests := []struct {
+		code      codes.Code
+		retryable bool
+		temporary bool
+	}{
+		{codes.Unavailable, true, true},
+		{codes.ResourceExhausted, true, true},
+		{codes.Aborted, true, true},
+		{codes.DeadlineExceeded, false, true},
+		{codes.PermissionDenied, false, false},
+		{codes.InvalidArgument, false, false},
+		{codes.Internal, false, false},
+	}
+	for _, tt := range tests {
+		err := WrapGRPCError(status.Error(tt.code, "failed"), "call failed")
+		if IsRetryable(err) != tt.retryable {
+			t.Errorf("Expected IsRetryable %v for %s", tt.retryable, tt.code)
+		}
+		if IsTemporary(err) != tt.temporary {
+			t.Errorf("Expected IsTemporary %v for %s", tt.temporary, tt.code)
+		}
+	}
+
+	if IsRetryable(errors.New("plain error")) || IsTemporary(nil) {
+		t.Error("Expected errors other than TogoMQError not to be retryable")
+	}
+}
+
+func TestTogoMQError_Details(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: "topic:orders"}}},
+	)
+	if err != nil {
+		t.Fatalf("WithDetails failed: %v", err)
+	}
+
+	var tmqErr *TogoMQError
+	if !errors.As(WrapGRPCError(st.Err(), "publish failed"), &tmqErr) {
+		t.Fatal("Expected TogoMQError")
+	}
+	if len(tmqErr.Details()) != 2 {
+		t.Fatalf("Expected 2 details, got %v", tmqErr.Details())
+	}
+	if quota, ok := tmqErr.Details()[1].(*errdetails.QuotaFailure); !ok || quota.Violations[0].Subject != "topic:orders" {
+		t.Errorf("Expected the QuotaFailure detail, got %v", tmqErr.Details()[1])
+	}
+	if delay, ok := tmqErr.RetryDelay(); !ok || delay != 3*time.Second {
+		t.Errorf("Expected a retry delay of 3s, got %v %v", delay, ok)
+	}
+
+	if _, ok := NewError(ErrCodePublish, "publish failed", nil).RetryDelay(); ok {
+		t.Error("Expected no retry delay without status")
+	}
+}
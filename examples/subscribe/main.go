@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/TogoMQ/togomq-sdk-go"
 )
@@ -39,6 +40,9 @@ func main() {
 
 	// Example 4: Advanced subscription with options
 	advancedSubscribe(client)
+
+	// Example 5: Handler-based consumer with worker pool
+	// consumerSubscribe(client)
 }
 
 // basicSubscribe demonstrates basic subscription to a specific topic
@@ -267,3 +271,31 @@ func advancedSubscribe(client *togomq.Client) {
 		}
 	}
 }
+
+// consumerSubscribe demonstrates a handler-based consumer with a pool of workers
+func consumerSubscribe(client *togomq.Client) {
+	fmt.Println("=== Consumer with Worker Pool Example ===")
+
+	// Cancel the context on Ctrl+C to start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	handler := togomq.HandlerFunc(func(ctx context.Context, msg *togomq.Message) error {
+		log.Printf("Handling message %s from %s: %s\n", msg.UUID, msg.Topic, string(msg.Body))
+		return nil
+	})
+
+	consumer := togomq.NewConsumer(client, togomq.NewSubscribeOptions("orders.*"), handler,
+		togomq.WithWorkers(8),                      // Handle up to 8 messages concurrently
+		togomq.WithShutdownTimeout(10*time.Second), // Give in-flight handlers 10s to finish
+	)
+
+	log.Println("Consuming messages matching pattern 'orders.*' with 8 workers... Press Ctrl+C to stop")
+
+	// Run returns once the shutdown has finished
+	if err := consumer.Run(ctx); err != nil {
+		log.Printf("Consumer stopped with error: %v\n", err)
+		return
+	}
+	log.Println("Consumer stopped gracefully")
+}
@@ -0,0 +1,281 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Adjustments of the negotiated rate
+const (
+	// flowDecrease is the share of the consumed rate negotiated when the consumer falls behind
+	flowDecrease = 0.75
+	// flowIncrease multiplies the negotiated rate when the consumer keeps up with it
+	flowIncrease = 1.25
+	// defaultBatch is the batch size used by the server when none is requested
+	defaultBatch = 1000
+	// flowSamples is the number of times the queue depth is sampled per interval
+	flowSamples = 10
+)
+
+// FlowControlOptions configures the adaptive flow control of Client.Sub.
+// Messages are prefetched into a buffered message channel, and the latency of their delivery and
+// the queue depth are measured, the depth also on a timer so that a consumer that stopped reading is
+// detected. The delivery rate is reported to metrics implementing FlowControlMetrics.
+//
+// With Renegotiate, the rate is also adapted: when the consumer falls behind, the stream is re-opened
+// with a lower SpeedPerSec and Batch; when it keeps up again, the rate is raised step by step.
+//
+// WARNING: re-negotiation may lose messages. The protocol cannot end a subscribe stream gracefully, so
+// the current stream is cancelled before the new one is opened. The messages already received on it are
+// delivered first, but those the server sent that were still in flight are lost unless the server
+// delivers them again. Only enable it where such losses are acceptable.
+type FlowControlOptions struct {
+	// QueueSize is the number of messages prefetched for the consumer (default: 100),
+	// replaced by the BufferSize of the subscription when set
+	QueueSize int
+	// TargetLatency is the delivery latency of a message above which the rate is lowered (default: 100ms)
+	TargetLatency time.Duration
+	// Interval is the period over which the delivery is measured before adjusting the rate (default: 5s)
+	Interval time.Duration
+	// MinSpeedPerSec is the lowest negotiated rate (default: 1)
+	MinSpeedPerSec int64
+	// MaxSpeedPerSec is the highest negotiated rate (0 = unlimited)
+	MaxSpeedPerSec int64
+	// Renegotiate re-opens the stream when the rate changes, which may lose in-flight messages (default: false)
+	Renegotiate bool
+}
+
+// NewFlowControlOptions creates FlowControlOptions with default values
+func NewFlowControlOptions() *FlowControlOptions {
+	return &FlowControlOptions{
+		QueueSize:      100,
+		TargetLatency:  100 * time.Millisecond,
+		Interval:       5 * time.Second,
+		MinSpeedPerSec: 1,
+		MaxSpeedPerSec: 0, // unlimited
+		Renegotiate:    false,
+	}
+}
+
+// WithQueueSize sets the number of messages prefetched for the consumer
+func (o *FlowControlOptions) WithQueueSize(size int) *FlowControlOptions {
+	o.QueueSize = size
+	return o
+}
+
+// WithTargetLatency sets the delivery latency above which the rate is lowered
+func (o *FlowControlOptions) WithTargetLatency(latency time.Duration) *FlowControlOptions {
+	o.TargetLatency = latency
+	return o
+}
+
+// WithInterval sets the period over which the delivery is measured
+func (o *FlowControlOptions) WithInterval(interval time.Duration) *FlowControlOptions {
+	o.Interval = interval
+	return o
+}
+
+// WithSpeedRange sets the lowest and highest negotiated rates (max 0 = unlimited)
+func (o *FlowControlOptions) WithSpeedRange(minSpeed, maxSpeed int64) *FlowControlOptions {
+	o.MinSpeedPerSec = minSpeed
+	o.MaxSpeedPerSec = maxSpeed
+	return o
+}
+
+// WithRenegotiation sets whether the stream is re-opened with the adapted rate.
+// The messages in flight on the cancelled stream may be lost, see FlowControlOptions.
+func (o *FlowControlOptions) WithRenegotiation(enabled bool) *FlowControlOptions {
+	o.Renegotiate = enabled
+	return o
+}
+
+// validate checks if the flow control options are valid
+func (o *FlowControlOptions) validate() error {
+	if o.QueueSize < 0 || o.TargetLatency < 0 || o.Interval < 0 {
+		return fmt.Errorf("flow control queue size, target latency and interval cannot be negative")
+	}
+	if o.MinSpeedPerSec < 0 || o.MaxSpeedPerSec < 0 {
+		return fmt.Errorf("flow control speeds cannot be negative")
+	}
+	if o.MaxSpeedPerSec > 0 && o.MinSpeedPerSec > o.MaxSpeedPerSec {
+		return fmt.Errorf("flow control min speed %d is above max speed %d", o.MinSpeedPerSec, o.MaxSpeedPerSec)
+	}
+	return nil
+}
+
+// flowController measures the delivery of a subscription and negotiates its rate.
+// It is shared by the receive loop and the flow control timer.
+type flowController struct {
+	opts     FlowControlOptions
+	maxBatch int64
+
+	mu sync.Mutex
+	// speed and batch are the negotiated values
+	speed int64
+	batch int64
+	// pending is set when the negotiated values changed and the stream must be re-opened
+	pending bool
+
+	// Measurements of the current interval
+	start     time.Time
+	delivered int
+	latency   time.Duration
+	depth     int
+	samples   int
+}
+
+// newFlowController creates a controller starting from the values of the subscription
+func newFlowController(opts *FlowControlOptions, sub *SubscribeOptions, now time.Time) *flowController {
+	defaults := NewFlowControlOptions()
+	f := &flowController{opts: *opts, maxBatch: sub.Batch, speed: sub.SpeedPerSec, start: now}
+	if f.opts.QueueSize <= 0 {
+		f.opts.QueueSize = defaults.QueueSize
+	}
+	if f.opts.TargetLatency <= 0 {
+		f.opts.TargetLatency = defaults.TargetLatency
+	}
+	if f.opts.Interval <= 0 {
+		f.opts.Interval = defaults.Interval
+	}
+	if f.opts.MinSpeedPerSec <= 0 {
+		f.opts.MinSpeedPerSec = defaults.MinSpeedPerSec
+	}
+	if f.maxBatch <= 0 {
+		f.maxBatch = defaultBatch
+	}
+	f.speed = f.clamp(f.speed)
+	f.batch = f.batchFor(f.speed)
+	return f
+}
+
+// clamp bounds a speed to the configured range, where 0 is unlimited
+func (f *flowController) clamp(speed int64) int64 {
+	if f.opts.MaxSpeedPerSec > 0 && (speed == 0 || speed > f.opts.MaxSpeedPerSec) {
+		return f.opts.MaxSpeedPerSec
+	}
+	if speed > 0 && speed < f.opts.MinSpeedPerSec {
+		return f.opts.MinSpeedPerSec
+	}
+	return speed
+}
+
+// batchFor returns the batch of a speed: one second of messages, at most the requested batch
+func (f *flowController) batchFor(speed int64) int64 {
+	if speed == 0 {
+		return f.maxBatch
+	}
+	return min(speed, f.maxBatch)
+}
+
+// apply sets the negotiated values on the subscribe options
+func (f *flowController) apply(sub *SubscribeOptions) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub.SpeedPerSec = f.speed
+	sub.Batch = f.batch
+}
+
+// renegotiate reports whether the negotiated values changed since the last call
+func (f *flowController) renegotiate() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pending := f.pending
+	f.pending = false
+	return pending
+}
+
+// observe records the delivery of a message and the depth of the queue after it
+func (f *flowController) observe(latency time.Duration, depth int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delivered++
+	f.latency += latency
+	f.depth += depth
+	f.samples++
+}
+
+// sample records the depth of the queue, whether messages are delivered or not
+func (f *flowController) sample(depth int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.depth += depth
+	f.samples++
+}
+
+// evaluate adjusts the rate once an interval has elapsed, if re-negotiation is enabled. It returns the
+// effective rate of the interval, whether it elapsed and whether the speed changed so that the stream
+// must be re-opened.
+func (f *flowController) evaluate(now time.Time) (rate float64, elapsed bool, changed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	interval := now.Sub(f.start)
+	if interval < f.opts.Interval {
+		return 0, false, false
+	}
+
+	rate = float64(f.delivered) / interval.Seconds()
+	var latency time.Duration
+	var depth float64
+	if f.delivered > 0 {
+		latency = f.latency / time.Duration(f.delivered)
+	}
+	if f.samples > 0 {
+		depth = float64(f.depth) / float64(f.samples)
+	}
+	f.start, f.delivered, f.latency, f.depth, f.samples = now, 0, 0, 0, 0
+	if !f.opts.Renegotiate {
+		return rate, true, false
+	}
+
+	speed := f.speed
+	queue := float64(f.opts.QueueSize)
+	switch {
+	case latency > f.opts.TargetLatency || depth > queue/2:
+		// The consumer falls behind: ask for less than it consumed so that the queue drains
+		speed = max(f.opts.MinSpeedPerSec, int64(rate*flowDecrease))
+		if f.speed > 0 {
+			speed = min(speed, f.speed)
+		}
+	case f.speed > 0 && latency < f.opts.TargetLatency/2 && depth < queue/4 && rate >= 0.9*float64(f.speed):
+		// The consumer keeps up with the limit
+		speed = int64(math.Ceil(float64(f.speed) * flowIncrease))
+	}
+	speed = f.clamp(speed)
+
+	if speed == f.speed {
+		return rate, true, false
+	}
+	f.speed = speed
+	f.batch = f.batchFor(speed)
+	f.pending = true
+	return rate, true, true
+}
+
+// runFlowControl samples the queue depth of a subscription and evaluates its flow control on a timer
+// until the subscription is closing. When the negotiated values change, it stops the current stream
+// so that the receive loop re-opens it with them.
+func (c *Client) runFlowControl(ctx context.Context, closing <-chan struct{}, flow *flowController, topic string, depth func() int, stopStream func()) {
+	ticker := time.NewTicker(max(flow.opts.Interval/flowSamples, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closing:
+			return
+		case now := <-ticker.C:
+			flow.sample(depth())
+			rate, elapsed, changed := flow.evaluate(now)
+			if !elapsed {
+				continue
+			}
+			c.subscriptionRate(topic, rate)
+			if changed {
+				stopStream()
+			}
+		}
+	}
+}
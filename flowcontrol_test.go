@@ -0,0 +1,329 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+// rateMetrics records the SubscriptionRate calls
+type rateMetrics struct {
+	NoopMetrics
+	mu    sync.Mutex
+	rates []float64
+}
+
+func (m *rateMetrics) SubscriptionRate(topic string, messagesPerSec float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rates = append(m.rates, messagesPerSec)
+}
+
+// observeInterval records n deliveries and evaluates the controller one interval later
+func observeInterval(f *flowController, now *time.Time, n int, latency time.Duration, depth int) (float64, bool) {
+	for i := 0; i < n; i++ {
+		f.observe(latency, depth)
+	}
+	*now = now.Add(f.opts.Interval)
+	rate, _, changed := f.evaluate(*now)
+	return rate, changed
+}
+
+func TestFlowController(t *testing.T) {
+	now := time.Now()
+	opts := NewFlowControlOptions().WithQueueSize(100).WithInterval(time.Second).WithSpeedRange(10, 300).WithRenegotiation(true)
+	f := newFlowController(opts, NewSubscribeOptions("orders").WithBatch(500), now)
+
+	// The max speed applies from the start
+	if f.speed != 300 || f.batch != 300 {
+		t.Fatalf("Expected speed and batch 300, got %d and %d", f.speed, f.batch)
+	}
+
+	if _, elapsed, _ := f.evaluate(now.Add(time.Millisecond)); elapsed {
+		t.Error("Expected no evaluation before the interval")
+	}
+
+	// A deep queue lowers the rate below the consumed one
+	rate, changed := observeInterval(f, &now, 200, time.Millisecond, 80)
+	if rate != 200 || !changed || f.speed != 150 || f.batch != 150 {
+		t.Errorf("Expected speed 150 for a consumer at 200/s, got rate %v speed %d", rate, f.speed)
+	}
+
+	// A high latency lowers it too, down to the min speed
+	observeInterval(f, &now, 5, time.Second, 0)
+	if f.speed != 10 || f.batch != 10 {
+		t.Errorf("Expected the min speed 10, got %d", f.speed)
+	}
+
+	// A consumer keeping up with the limit raises it step by step
+	if _, changed := observeInterval(f, &now, 10, 0, 0); !changed || f.speed != 13 {
+		t.Errorf("Expected speed 13, got %d", f.speed)
+	}
+	// A consumer below the limit without backlog keeps it
+	if _, changed := observeInterval(f, &now, 5, 0, 0); changed {
+		t.Errorf("Expected the speed to be kept, got %d", f.speed)
+	}
+
+	for i := 0; i < 30; i++ {
+		observeInterval(f, &now, int(f.speed), 0, 0)
+	}
+	if f.speed != 300 || f.batch != 300 {
+		t.Errorf("Expected the speed to reach the max 300, got %d", f.speed)
+	}
+}
+
+func TestFlowController_Unlimited(t *testing.T) {
+	now := time.Now()
+	opts := NewFlowControlOptions().WithInterval(time.Second).WithRenegotiation(true)
+	f := newFlowController(opts, NewSubscribeOptions("orders"), now)
+	if f.speed != 0 || f.batch != defaultBatch {
+		t.Fatalf("Expected an unlimited speed and the default batch, got %d and %d", f.speed, f.batch)
+	}
+
+	// An unlimited subscription stays unlimited while the consumer keeps up
+	if _, changed := observeInterval(f, &now, 1000, 0, 0); changed {
+		t.Errorf("Expected no change, got speed %d", f.speed)
+	}
+	if _, changed := observeInterval(f, &now, 1000, 0, 90); !changed || f.speed != 750 {
+		t.Errorf("Expected speed 750, got %d", f.speed)
+	}
+}
+
+func TestFlowController_Stalled(t *testing.T) {
+	now := time.Now()
+	opts := NewFlowControlOptions().WithQueueSize(10).WithInterval(time.Second).WithSpeedRange(5, 0).WithRenegotiation(true)
+	f := newFlowController(opts, NewSubscribeOptions("orders").WithSpeedPerSec(100), now)
+
+	// A consumer that stopped reading delivers nothing, but the sampled queue is full
+	for i := 0; i < flowSamples; i++ {
+		f.sample(10)
+	}
+	if _, changed := observeInterval(f, &now, 0, 0, 0); !changed || f.speed != 5 {
+		t.Errorf("Expected the min speed 5 for a stalled consumer, got %d", f.speed)
+	}
+	if !f.renegotiate() || f.renegotiate() {
+		t.Error("Expected one pending renegotiation")
+	}
+
+	// Without messages nor backlog, the speed is kept
+	if _, changed := observeInterval(f, &now, 0, 0, 0); changed {
+		t.Errorf("Expected the speed to be kept, got %d", f.speed)
+	}
+}
+
+func TestFlowController_NoRenegotiation(t *testing.T) {
+	now := time.Now()
+	opts := NewFlowControlOptions().WithQueueSize(10).WithInterval(time.Second)
+	f := newFlowController(opts, NewSubscribeOptions("orders").WithSpeedPerSec(100), now)
+
+	// A consumer falling behind is measured, but the speed is kept
+	rate, changed := observeInterval(f, &now, 50, time.Second, 10)
+	if rate != 50 || changed || f.speed != 100 {
+		t.Errorf("Expected rate 50 and the speed kept, got rate %v speed %d", rate, f.speed)
+	}
+	if f.renegotiate() {
+		t.Error("Expected no pending renegotiation")
+	}
+}
+
+func TestSub_FlowControl(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*mqv1.SubMessageRequest
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+			// The server ignores the speed and sends a backlog as fast as the stream allows
+			for i := 0; i < 200; i++ {
+				err := stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: fmt.Sprintf("%d-%d", call, i)})
+				if err != nil {
+					return err
+				}
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	metrics := &rateMetrics{}
+	client.config.Metrics = metrics
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := NewSubscribeOptions("orders").
+		WithFlowControl(NewFlowControlOptions().WithQueueSize(10).WithInterval(50 * time.Millisecond).WithRenegotiation(true))
+	msgChan, _, err := client.Sub(ctx, opts)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if cap(msgChan) != 10 {
+		t.Errorf("Expected a prefetch of 10 messages, got %d", cap(msgChan))
+	}
+
+	// A slow consumer makes the subscription re-open its stream with a lower speed
+	for {
+		mu.Lock()
+		n := len(requests)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		select {
+		case <-msgChan:
+			time.Sleep(2 * time.Millisecond)
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the stream to be re-opened")
+		}
+	}
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests[0].SpeedPerSec != 0 || requests[0].Batch != defaultBatch {
+		t.Errorf("Expected the first stream to be unlimited, got %+v", requests[0])
+	}
+	if requests[1].SpeedPerSec <= 0 || requests[1].SpeedPerSec > 500 || requests[1].Batch != requests[1].SpeedPerSec {
+		t.Errorf("Expected a speed below the consumer rate, got %+v", requests[1])
+	}
+	if opts.SpeedPerSec != 0 {
+		t.Error("Expected the subscribe options not to be modified")
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.rates) == 0 || metrics.rates[0] <= 0 {
+		t.Errorf("Expected the delivery rate to be reported, got %v", metrics.rates)
+	}
+}
+
+func TestSub_FlowControlDeliversReceived(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*mqv1.SubMessageRequest
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+			if call == 1 {
+				for i := 0; i < 50; i++ {
+					if err := stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: fmt.Sprint(i)}); err != nil {
+						return err
+					}
+				}
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := NewSubscribeOptions("orders").
+		WithFlowControl(NewFlowControlOptions().WithQueueSize(10).WithInterval(20 * time.Millisecond).WithRenegotiation(true))
+	msgChan, _, err := client.Sub(ctx, opts)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	// The consumer stalls while the queue is full, then the stream is re-opened with a lower speed
+	time.Sleep(100 * time.Millisecond)
+
+	// The messages received on the stopped stream are still delivered, in order
+	for i := 0; i < 50; i++ {
+		select {
+		case msg := <-msgChan:
+			if msg.UUID != fmt.Sprint(i) {
+				t.Fatalf("Expected message %d, got %s", i, msg.UUID)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for message %d", i)
+		}
+	}
+
+	for {
+		mu.Lock()
+		n := len(requests)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the stream to be re-opened")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests[1].SpeedPerSec <= 0 {
+		t.Errorf("Expected a limited speed for the stalled consumer, got %+v", requests[1])
+	}
+}
+
+func TestSub_FlowControlWithoutRenegotiation(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*mqv1.SubMessageRequest
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+			for i := 0; i < 50; i++ {
+				if err := stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: fmt.Sprint(i)}); err != nil {
+					return err
+				}
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	metrics := &rateMetrics{}
+	client.config.Metrics = metrics
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := NewSubscribeOptions("orders").
+		WithFlowControl(NewFlowControlOptions().WithQueueSize(10).WithInterval(20 * time.Millisecond))
+	msgChan, _, err := client.Sub(ctx, opts)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	// The consumer stalls for several intervals, then every message is delivered on the first stream
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 50; i++ {
+		select {
+		case msg := <-msgChan:
+			if msg.UUID != fmt.Sprint(i) {
+				t.Fatalf("Expected message %d, got %s", i, msg.UUID)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for message %d", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 {
+		t.Errorf("Expected the stream to be opened once, got %d", len(requests))
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.rates) == 0 {
+		t.Error("Expected the delivery rate to be reported")
+	}
+}
+
+func TestSub_FlowControlValidation(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(0))
+	opts := NewSubscribeOptions("orders").WithFlowControl(NewFlowControlOptions().WithSpeedRange(10, 5))
+	if _, _, err := client.Sub(context.Background(), opts); decodeErrCode(err) != ErrCodeValidation {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
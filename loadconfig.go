@@ -0,0 +1,461 @@
+package togomq
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by ConfigFromEnv and LoadConfig
+const DefaultEnvPrefix = "TOGOMQ"
+
+// setting is a Config value that can be loaded from a file or the environment
+type setting struct {
+	// key is the file key, nested keys are separated by dots, e.g. "tls.ca_file"
+	key string
+	// field is the Config field named in validation errors
+	field string
+	// size reports whether the value is a size in bytes
+	size bool
+	set  func(c *Config, value string) error
+	get  func(c *Config) any
+}
+
+// settings are the Config values that can be loaded. Functions, interfaces and keys, such as
+// middleware, TokenSource or Encryption, can only be set with options.
+var settings = []setting{
+	stringSetting("host", "Host", func(c *Config) *string { return &c.Host }),
+	intSetting("port", "Port", func(c *Config) *int { return &c.Port }),
+	{
+		key: "endpoints", field: "Endpoints",
+		set: func(c *Config, v string) error {
+			c.Endpoints = nil
+			for _, endpoint := range strings.Split(v, ",") {
+				if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+					c.Endpoints = append(c.Endpoints, endpoint)
+				}
+			}
+			return nil
+		},
+		get: func(c *Config) any { return strings.Join(c.Endpoints, ",") },
+	},
+	{
+		key: "load_balancing", field: "LoadBalancing",
+		set: func(c *Config, v string) error { c.LoadBalancing = LoadBalancing(v); return nil },
+		get: func(c *Config) any { return c.LoadBalancing },
+	},
+	boolSetting("health_check", "HealthCheck", func(c *Config) *bool { return &c.HealthCheck }),
+	stringSetting("log_level", "LogLevel", func(c *Config) *string { return &c.LogLevel }),
+	stringSetting("token", "Token", func(c *Config) *string { return &c.Token }),
+	boolSetting("use_tls", "UseTLS", func(c *Config) *bool { return &c.UseTLS }),
+	sizeSetting("max_message_size", "MaxMessageSize", func(c *Config) *int { return &c.MaxMessageSize }),
+	size32Setting("initial_window_size", "InitialWindowSize", func(c *Config) *int32 { return &c.InitialWindowSize }),
+	size32Setting("initial_conn_window_size", "InitialConnWindowSize", func(c *Config) *int32 { return &c.InitialConnWindowSize }),
+	sizeSetting("write_buffer_size", "WriteBufferSize", func(c *Config) *int { return &c.WriteBufferSize }),
+	sizeSetting("read_buffer_size", "ReadBufferSize", func(c *Config) *int { return &c.ReadBufferSize }),
+	durationSetting("keepalive_time", "KeepaliveTime", func(c *Config) *time.Duration { return &c.KeepaliveTime }),
+	durationSetting("keepalive_timeout", "KeepaliveTimeout", func(c *Config) *time.Duration { return &c.KeepaliveTimeout }),
+	{
+		key: "compression", field: "Compression",
+		set: func(c *Config, v string) error { c.Compression = Compression(v); return nil },
+		get: func(c *Config) any { return c.Compression },
+	},
+	sizeSetting("compression_threshold", "CompressionThreshold", func(c *Config) *int { return &c.CompressionThreshold }),
+
+	stringSetting("tls.ca_file", "TLS", func(c *Config) *string { return &tlsOptions(c).CAFile }),
+	stringSetting("tls.cert_file", "TLS", func(c *Config) *string { return &tlsOptions(c).CertFile }),
+	stringSetting("tls.key_file", "TLS", func(c *Config) *string { return &tlsOptions(c).KeyFile }),
+	stringSetting("tls.server_name", "TLS", func(c *Config) *string { return &tlsOptions(c).ServerName }),
+	boolSetting("tls.insecure_skip_verify", "TLS", func(c *Config) *bool { return &tlsOptions(c).InsecureSkipVerify }),
+	{
+		key: "tls.min_version", field: "TLS",
+		set: func(c *Config, v string) error {
+			versions := map[string]uint16{
+				"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13,
+			}
+			version, ok := versions[v]
+			if !ok {
+				return fmt.Errorf("unsupported TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", v)
+			}
+			tlsOptions(c).MinVersion = version
+			return nil
+		},
+		get: func(c *Config) any {
+			return readSetting(c, func(c *Config) *uint16 { return &tlsOptions(c).MinVersion })
+		},
+	},
+
+	intSetting("retry.max_attempts", "RetryPolicy", func(c *Config) *int { return &retryPolicy(c).MaxAttempts }),
+	durationSetting("retry.per_attempt_timeout", "RetryPolicy", func(c *Config) *time.Duration { return &retryPolicy(c).PerAttemptTimeout }),
+	durationSetting("retry.initial_delay", "RetryPolicy", func(c *Config) *time.Duration { return &retryPolicy(c).Backoff.InitialDelay }),
+	durationSetting("retry.max_delay", "RetryPolicy", func(c *Config) *time.Duration { return &retryPolicy(c).Backoff.MaxDelay }),
+	floatSetting("retry.multiplier", "RetryPolicy", func(c *Config) *float64 { return &retryPolicy(c).Backoff.Multiplier }),
+	floatSetting("retry.jitter", "RetryPolicy", func(c *Config) *float64 { return &retryPolicy(c).Backoff.Jitter }),
+
+	floatSetting("rate_limit.messages_per_sec", "RateLimit", func(c *Config) *float64 { return &rateLimitOptions(c).MessagesPerSec }),
+	sizeSetting("rate_limit.bytes_per_sec", "RateLimit", func(c *Config) *int { return &rateLimitOptions(c).BytesPerSec }),
+	intSetting("rate_limit.message_burst", "RateLimit", func(c *Config) *int { return &rateLimitOptions(c).MessageBurst }),
+	sizeSetting("rate_limit.byte_burst", "RateLimit", func(c *Config) *int { return &rateLimitOptions(c).ByteBurst }),
+	{
+		key: "rate_limit.mode", field: "RateLimit",
+		set: func(c *Config, v string) error { rateLimitOptions(c).Mode = RateLimitMode(v); return nil },
+		get: func(c *Config) any {
+			return readSetting(c, func(c *Config) *RateLimitMode { return &rateLimitOptions(c).Mode })
+		},
+	},
+}
+
+// tlsOptions returns the TLS options of the config, creating them when needed
+func tlsOptions(c *Config) *TLSOptions {
+	if c.TLS == nil {
+		c.TLS = NewTLSOptions()
+	}
+	return c.TLS
+}
+
+// rateLimitOptions returns the rate limit of the config, creating an unlimited one when needed
+func rateLimitOptions(c *Config) *RateLimitOptions {
+	if c.RateLimit == nil {
+		c.RateLimit = NewRateLimitOptions(0)
+	}
+	return c.RateLimit
+}
+
+// retryPolicy returns the retry policy of the config, creating the default one when needed
+func retryPolicy(c *Config) *RetryPolicy {
+	if c.RetryPolicy == nil {
+		c.RetryPolicy = DefaultRetryPolicy()
+	}
+	return c.RetryPolicy
+}
+
+func stringSetting(key, field string, ptr func(*Config) *string) setting {
+	return setting{
+		key: key, field: field,
+		set: func(c *Config, v string) error { *ptr(c) = v; return nil },
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+func boolSetting(key, field string, ptr func(*Config) *bool) setting {
+	return setting{
+		key: key, field: field,
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", v)
+			}
+			*ptr(c) = b
+			return nil
+		},
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+func intSetting(key, field string, ptr func(*Config) *int) setting {
+	return setting{
+		key: key, field: field,
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", v)
+			}
+			*ptr(c) = n
+			return nil
+		},
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+func sizeSetting(key, field string, ptr func(*Config) *int) setting {
+	return setting{
+		key: key, field: field, size: true,
+		set: func(c *Config, v string) error {
+			n, err := parseSize(v, strconv.IntSize)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = int(n)
+			return nil
+		},
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+func size32Setting(key, field string, ptr func(*Config) *int32) setting {
+	return setting{
+		key: key, field: field, size: true,
+		set: func(c *Config, v string) error {
+			n, err := parseSize(v, 32)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = int32(n)
+			return nil
+		},
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+// sizeUnits are the units of human-readable sizes, in powers of 1024
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30}, {"GiB", 1 << 30}, {"G", 1 << 30},
+	{"MB", 1 << 20}, {"MiB", 1 << 20}, {"M", 1 << 20},
+	{"KB", 1 << 10}, {"KiB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size in bytes such as "1048576", "512KB" or "10MB" that fits in bits
+func parseSize(v string, bits int) (int64, error) {
+	s := strings.TrimSpace(v)
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if len(s) > len(unit.suffix) && strings.EqualFold(s[len(s)-len(unit.suffix):], unit.suffix) {
+			s, multiplier = strings.TrimSpace(s[:len(s)-len(unit.suffix)]), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	limit := int64(1)<<(bits-1) - 1
+	if err != nil || n > limit/multiplier || n < -limit/multiplier {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. \"512KB\" or \"10MB\"", v)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a size in bytes with the largest unit that divides it
+func formatSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n != 0 && n%unit.bytes == 0 {
+			return strconv.FormatInt(n/unit.bytes, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func floatSetting(key, field string, ptr func(*Config) *float64) setting {
+	return setting{
+		key: key, field: field,
+		set: func(c *Config, v string) error {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", v)
+			}
+			*ptr(c) = f
+			return nil
+		},
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+func durationSetting(key, field string, ptr func(*Config) *time.Duration) setting {
+	return setting{
+		key: key, field: field,
+		set: func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid duration %q, expected e.g. \"30s\" or \"1m\"", v)
+			}
+			*ptr(c) = d
+			return nil
+		},
+		get: func(c *Config) any { return readSetting(c, ptr) },
+	}
+}
+
+// readSetting returns the value of a setting without creating the TLS options or retry policy
+func readSetting[T any](c *Config, ptr func(*Config) *T) any {
+	probe := *c
+	return *ptr(&probe)
+}
+
+// envName returns the environment variable of a setting, e.g. TOGOMQ_TLS_CA_FILE
+func (s setting) envName(prefix string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// apply sets the value of the setting and records its source
+func (s setting) apply(c *Config, value, source string) error {
+	if err := s.set(c, value); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[s.field] = source
+	return nil
+}
+
+// envPrefix normalizes an environment variable prefix
+func envPrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "_")
+	if prefix == "" {
+		return DefaultEnvPrefix
+	}
+	return prefix
+}
+
+// ConfigFromEnv returns the default Config overridden by the environment variables with the prefix
+// (default: TOGOMQ), e.g. TOGOMQ_HOST, TOGOMQ_KEEPALIVE_TIME=30s or TOGOMQ_TLS_CA_FILE.
+// The Config is not validated.
+func ConfigFromEnv(prefix string) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := cfg.loadEnv(prefix); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadEnv overrides the config with the environment variables with the prefix
+func (c *Config) loadEnv(prefix string) error {
+	prefix = envPrefix(prefix)
+	for _, s := range settings {
+		name := s.envName(prefix)
+		if value, ok := os.LookupEnv(name); ok {
+			if err := s.apply(c, value, "env "+name); err != nil {
+				return NewError(ErrCodeConfiguration, "invalid environment variable", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigFromFile returns the default Config overridden by a YAML, JSON or TOML file, chosen by
+// the file extension. Keys are the snake_case names of the fields, e.g. keepalive_time: 30s,
+// with tls and retry sections. The Config is not validated.
+func ConfigFromFile(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := cfg.loadFile(path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overrides the config with the values of a file
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NewError(ErrCodeConfiguration, "failed to read config file", err)
+	}
+
+	var values map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return NewError(ErrCodeConfiguration, fmt.Sprintf("unsupported config file extension %q, expected .yaml, .yml, .json or .toml", ext), nil)
+	}
+	if err != nil {
+		return NewError(ErrCodeConfiguration, fmt.Sprintf("failed to parse config file %s", path), err)
+	}
+
+	flat := make(map[string]string)
+	if err := flatten("", values, flat); err != nil {
+		return NewError(ErrCodeConfiguration, fmt.Sprintf("invalid config file %s", path), err)
+	}
+	for _, s := range settings {
+		value, ok := flat[s.key]
+		if !ok {
+			continue
+		}
+		delete(flat, s.key)
+		if err := s.apply(c, value, fmt.Sprintf("file %s (%s)", path, s.key)); err != nil {
+			return NewError(ErrCodeConfiguration, "invalid config file value", err)
+		}
+	}
+	if len(flat) > 0 {
+		unknown := make([]string, 0, len(flat))
+		for key := range flat {
+			unknown = append(unknown, key)
+		}
+		sort.Strings(unknown)
+		return NewError(ErrCodeConfiguration, fmt.Sprintf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", ")), nil)
+	}
+	return nil
+}
+
+// flatten converts nested file values to dotted keys and string values
+func flatten(prefix string, values map[string]any, flat map[string]string) error {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			if err := flatten(key, v, flat); err != nil {
+				return err
+			}
+		case []any:
+			// Lists, such as endpoints, are comma-separated like in environment variables
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			flat[key] = strings.Join(items, ",")
+		case string:
+			flat[key] = v
+		case bool, int, int64, uint64:
+			flat[key] = fmt.Sprint(v)
+		case float64:
+			flat[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("unsupported value for key %s", key)
+		}
+	}
+	return nil
+}
+
+// LoadConfig builds a Config from layered sources, each overriding the previous ones:
+// the defaults, the file at path (skipped when empty), the environment variables with
+// envPrefix (default: TOGOMQ) and the options. The Config is validated, and errors about
+// values from the file or the environment name their source.
+func LoadConfig(path, envPrefix string, opts ...ConfigOption) (*Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(envPrefix); err != nil {
+		return nil, err
+	}
+
+	before := make([]any, len(settings))
+	for i, s := range settings {
+		before[i] = s.get(cfg)
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	// Values changed by the options no longer come from the file or the environment
+	for i, s := range settings {
+		if !reflect.DeepEqual(before[i], s.get(cfg)) {
+			delete(cfg.sources, s.field)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, NewError(ErrCodeValidation, "invalid configuration", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,185 @@
+package togomq
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a config file in a temporary directory and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestConfigFromFile_Formats(t *testing.T) {
+	files := map[string]string{
+		"togomq.yaml": `
+host: mq.internal
+port: 9000
+token: secret
+keepalive_time: 30s
+initial_window_size: 1048576
+compression: zstd
+tls:
+  ca_file: /etc/togomq/ca.pem
+  min_version: "1.3"
+retry:
+  max_attempts: 5
+  initial_delay: 250ms
+  multiplier: 1.5
+`,
+		"togomq.json": `{
+  "host": "mq.internal",
+  "port": 9000,
+  "token": "secret",
+  "keepalive_time": "30s",
+  "initial_window_size": 1048576,
+  "compression": "zstd",
+  "tls": {"ca_file": "/etc/togomq/ca.pem", "min_version": "1.3"},
+  "retry": {"max_attempts": 5, "initial_delay": "250ms", "multiplier": 1.5}
+}`,
+		"togomq.toml": `
+host = "mq.internal"
+port = 9000
+token = "secret"
+keepalive_time = "30s"
+initial_window_size = 1048576
+compression = "zstd"
+
+[tls]
+ca_file = "/etc/togomq/ca.pem"
+min_version = "1.3"
+
+[retry]
+max_attempts = 5
+initial_delay = "250ms"
+multiplier = 1.5
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := ConfigFromFile(writeConfigFile(t, name, content))
+			if err != nil {
+				t.Fatalf("ConfigFromFile failed: %v", err)
+			}
+			if cfg.Host != "mq.internal" || cfg.Port != 9000 || cfg.Token != "secret" {
+				t.Errorf("Unexpected connection settings: %s:%d %q", cfg.Host, cfg.Port, cfg.Token)
+			}
+			if cfg.KeepaliveTime != 30*time.Second || cfg.InitialWindowSize != 1048576 || cfg.Compression != CompressionZstd {
+				t.Errorf("Unexpected settings: %v %d %q", cfg.KeepaliveTime, cfg.InitialWindowSize, cfg.Compression)
+			}
+			if cfg.TLS == nil || cfg.TLS.CAFile != "/etc/togomq/ca.pem" || cfg.TLS.MinVersion != tls.VersionTLS13 {
+				t.Errorf("Unexpected TLS options: %+v", cfg.TLS)
+			}
+			if cfg.RetryPolicy == nil || cfg.RetryPolicy.MaxAttempts != 5 ||
+				cfg.RetryPolicy.Backoff.InitialDelay != 250*time.Millisecond || cfg.RetryPolicy.Backoff.Multiplier != 1.5 {
+				t.Errorf("Unexpected retry policy: %+v", cfg.RetryPolicy)
+			}
+			// Values not in the file keep their defaults
+			if cfg.KeepaliveTimeout != DefaultConfig().KeepaliveTimeout || len(cfg.RetryPolicy.RetryableErrCodes) == 0 {
+				t.Error("Expected unset values to keep their defaults")
+			}
+		})
+	}
+}
+
+func TestConfigFromFile_Errors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"unknown key", "c.yaml", "host: h\nkeepalive: 30s\n", "unknown keys in config file"},
+		{"invalid duration", "c.yaml", "keepalive_time: 30\n", "invalid duration"},
+		{"invalid integer", "c.json", `{"port": "http"}`, "invalid integer"},
+		{"invalid syntax", "c.toml", "host = \n", "failed to parse config file"},
+		{"unsupported extension", "c.ini", "host=h", "unsupported config file extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConfigFromFile(writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := ConfigFromFile("/nonexistent/togomq.yaml"); decodeErrCode(err) != ErrCodeConfiguration {
+		t.Errorf("Expected a configuration error for a missing file, got %v", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("APP_MQ_HOST", "env.internal")
+	t.Setenv("APP_MQ_USE_TLS", "false")
+	t.Setenv("APP_MQ_KEEPALIVE_TIMEOUT", "5s")
+	t.Setenv("APP_MQ_RETRY_MAX_ATTEMPTS", "2")
+
+	cfg, err := ConfigFromEnv("APP_MQ_")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if cfg.Host != "env.internal" || cfg.UseTLS || cfg.KeepaliveTimeout != 5*time.Second {
+		t.Errorf("Unexpected config: %s %v %v", cfg.Host, cfg.UseTLS, cfg.KeepaliveTimeout)
+	}
+	if cfg.RetryPolicy == nil || cfg.RetryPolicy.MaxAttempts != 2 {
+		t.Errorf("Unexpected retry policy: %+v", cfg.RetryPolicy)
+	}
+
+	t.Setenv("TOGOMQ_PORT", "many")
+	if _, err := ConfigFromEnv(""); err == nil || !strings.Contains(err.Error(), "env TOGOMQ_PORT") {
+		t.Errorf("Expected an error naming TOGOMQ_PORT, got %v", err)
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := writeConfigFile(t, "togomq.yaml", "host: file.internal\nport: 9000\ntoken: file-token\nlog_level: debug\n")
+	t.Setenv("TOGOMQ_PORT", "9100")
+	t.Setenv("TOGOMQ_TOKEN", "env-token")
+
+	cfg, err := LoadConfig(path, "", WithToken("option-token"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Host != "file.internal" || cfg.LogLevel != "debug" {
+		t.Errorf("Expected file values over defaults, got %s %s", cfg.Host, cfg.LogLevel)
+	}
+	if cfg.Port != 9100 {
+		t.Errorf("Expected the environment over the file, got port %d", cfg.Port)
+	}
+	if cfg.Token != "option-token" {
+		t.Errorf("Expected options over the environment, got token %q", cfg.Token)
+	}
+	if cfg.KeepaliveTime != DefaultConfig().KeepaliveTime {
+		t.Errorf("Expected the default keepalive time, got %v", cfg.KeepaliveTime)
+	}
+}
+
+func TestLoadConfig_ValidationNamesSource(t *testing.T) {
+	path := writeConfigFile(t, "togomq.toml", "token = \"t\"\nkeepalive_time = \"-1s\"\n")
+
+	_, err := LoadConfig(path, "")
+	if err == nil || !strings.Contains(err.Error(), "keepalive time must be greater than 0") ||
+		!strings.Contains(err.Error(), "KeepaliveTime set by file "+path+" (keepalive_time)") {
+		t.Errorf("Expected an error naming the file, got %v", err)
+	}
+
+	t.Setenv("TOGOMQ_PORT", "70000")
+	_, err = LoadConfig(path, "", WithKeepaliveTime(time.Second))
+	if err == nil || !strings.Contains(err.Error(), "Port set by env TOGOMQ_PORT") {
+		t.Errorf("Expected an error naming TOGOMQ_PORT, got %v", err)
+	}
+
+	// A bad value overridden by an option is no longer attributed to the environment
+	_, err = LoadConfig(path, "", WithKeepaliveTime(time.Second), WithPort(0))
+	if err == nil || strings.Contains(err.Error(), "TOGOMQ_PORT") {
+		t.Errorf("Expected an error without a source, got %v", err)
+	}
+}
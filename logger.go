@@ -1,9 +1,13 @@
 package togomq
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"strings"
+
+	"google.golang.org/grpc/status"
 )
 
 // LogLevel represents the logging level
@@ -22,6 +26,16 @@ const (
 	LogLevelNone
 )
 
+// Attribute keys of the structured fields attached to SDK log lines
+const (
+	LogKeyOperation = "operation"
+	LogKeyTopic     = "topic"
+	LogKeyUUID      = "uuid"
+	LogKeyCount     = "count"
+	LogKeyGRPCCode  = "grpc_code"
+	LogKeyError     = "error"
+)
+
 // ParseLogLevel converts a string to LogLevel
 func ParseLogLevel(level string) LogLevel {
 	switch strings.ToLower(level) {
@@ -40,49 +54,180 @@ func ParseLogLevel(level string) LogLevel {
 	}
 }
 
-// Logger provides logging functionality for the SDK
+// slogLevel converts a LogLevel to the equivalent slog.Level
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		// Above every level used by the SDK
+		return slog.LevelError + 4
+	}
+}
+
+// Logger provides logging functionality for the SDK.
+// It writes structured records to a *slog.Logger; messages are formatted with fmt.Sprintf.
 type Logger struct {
-	level LogLevel
+	logger *slog.Logger
 }
 
-// NewLogger creates a new logger with the specified level
+// NewLogger creates a new logger with the specified level that writes
+// through the standard library logger with a [LEVEL] prefix
 func NewLogger(level LogLevel) *Logger {
+	return NewSlogLogger(slog.New(&legacyHandler{level: level.slogLevel()}))
+}
+
+// NewSlogLogger creates a new logger that writes to the given *slog.Logger
+func NewSlogLogger(logger *slog.Logger) *Logger {
 	return &Logger{
-		level: level,
+		logger: logger,
 	}
 }
 
+// With returns a logger that adds the given key-value pairs to every log line
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{
+		logger: l.logger.With(args...),
+	}
+}
+
+// WithError returns a logger that adds the error and its gRPC code to every log line
+func (l *Logger) WithError(err error) *Logger {
+	args := []interface{}{LogKeyError, err}
+	if st, ok := status.FromError(err); ok && err != nil {
+		args = append(args, LogKeyGRPCCode, st.Code().String())
+	}
+	return l.With(args...)
+}
+
+// enabled reports whether messages of the level are written.
+// Hot paths check it before adding fields with With, which allocates a logger.
+func (l *Logger) enabled(level slog.Level) bool {
+	return l.logger.Enabled(context.Background(), level)
+}
+
+// log formats and writes a message if the level is enabled
+func (l *Logger) log(level slog.Level, format string, args ...interface{}) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+	l.logger.Log(ctx, level, msg)
+}
+
 // Debug logs a debug message
 func (l *Logger) Debug(format string, args ...interface{}) {
-	if l.level <= LogLevelDebug {
-		log.Printf("[DEBUG] "+format, args...)
-	}
+	l.log(slog.LevelDebug, format, args...)
 }
 
 // Info logs an info message
 func (l *Logger) Info(format string, args ...interface{}) {
-	if l.level <= LogLevelInfo {
-		log.Printf("[INFO] "+format, args...)
-	}
+	l.log(slog.LevelInfo, format, args...)
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(format string, args ...interface{}) {
-	if l.level <= LogLevelWarn {
-		log.Printf("[WARN] "+format, args...)
-	}
+	l.log(slog.LevelWarn, format, args...)
 }
 
 // Error logs an error message
 func (l *Logger) Error(format string, args ...interface{}) {
-	if l.level <= LogLevelError {
-		log.Printf("[ERROR] "+format, args...)
-	}
+	l.log(slog.LevelError, format, args...)
 }
 
 // Errorf logs an error message and returns a formatted error
 func (l *Logger) Errorf(format string, args ...interface{}) error {
 	err := fmt.Errorf(format, args...)
-	l.Error(err.Error())
+	l.Error("%s", err.Error())
 	return err
 }
+
+// legacyHandler is a slog.Handler that writes "[LEVEL] message key=value" lines
+// through the standard library logger
+type legacyHandler struct {
+	level  slog.Level
+	attrs  []slog.Attr
+	groups []string
+}
+
+// Enabled reports whether the handler handles records at the given level
+func (h *legacyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+// Handle writes the record
+func (h *legacyHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(r.Level.String())
+	b.WriteString("] ")
+	b.WriteString(r.Message)
+
+	for _, attr := range h.attrs {
+		writeAttr(&b, "", attr)
+	}
+	prefix := strings.Join(h.groups, ".")
+	r.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&b, prefix, attr)
+		return true
+	})
+
+	log.Print(b.String())
+	return nil
+}
+
+// WithAttrs returns a handler that adds the attributes to every record
+func (h *legacyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := strings.Join(h.groups, ".")
+	next := &legacyHandler{level: h.level, groups: h.groups}
+	next.attrs = append(next.attrs, h.attrs...)
+	for _, attr := range attrs {
+		if prefix != "" {
+			attr.Key = prefix + "." + attr.Key
+		}
+		next.attrs = append(next.attrs, attr)
+	}
+	return next
+}
+
+// WithGroup returns a handler that qualifies the keys of later attributes with the group name
+func (h *legacyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := &legacyHandler{level: h.level, attrs: h.attrs}
+	next.groups = append(append(next.groups, h.groups...), name)
+	return next
+}
+
+// writeAttr appends " key=value" to the builder, flattening groups
+func writeAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	key := attr.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, a := range attr.Value.Group() {
+			writeAttr(b, key, a)
+		}
+		return
+	}
+
+	fmt.Fprintf(b, " %s=%v", key, attr.Value.Any())
+}
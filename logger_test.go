@@ -0,0 +1,149 @@
+package togomq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogger_LegacyOutput(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	logger := NewLogger(LogLevelInfo)
+	logger.Debug("hidden")
+	logger.With(LogKeyTopic, "orders").Info("Received %d messages", 3)
+	logger.WithError(status.Error(codes.Unavailable, "down")).Warn("Failed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d: %q", len(lines), buf.String())
+	}
+	if lines[0] != "[INFO] Received 3 messages topic=orders" {
+		t.Errorf("Unexpected log line: %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "[WARN] Failed error=") || !strings.HasSuffix(lines[1], "grpc_code=Unavailable") {
+		t.Errorf("Unexpected log line: %q", lines[1])
+	}
+}
+
+func TestLogger_None(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	logger := NewLogger(LogLevelNone)
+	logger.Error("hidden")
+	if err := logger.Errorf("failed: %s", "reason"); err == nil || err.Error() != "failed: reason" {
+		t.Errorf("Unexpected error from Errorf: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output, got %q", buf.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records(t *testing.T) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid JSON log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogger_StructuredAttributes(t *testing.T) {
+	buf := &syncBuffer{}
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		},
+	}
+	client := newTestClient(t, srv)
+	client.logger = NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if _, err := client.CountMessages(context.Background(), "orders.*"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	var found bool
+	for _, record := range buf.records(t) {
+		if record["operation"] != opCountMessages || record["topic"] != "orders.*" {
+			t.Errorf("Expected operation and topic attributes, got %v", record)
+		}
+		if record["level"] == "ERROR" {
+			found = true
+			if record["grpc_code"] != "PermissionDenied" {
+				t.Errorf("Expected grpc_code attribute, got %v", record)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected an error log record")
+	}
+}
+
+func TestNewClient_Logger(t *testing.T) {
+	buf := &syncBuffer{}
+	cfg := NewConfig(
+		WithToken("test-token"),
+		WithLogger(slog.New(slog.NewJSONHandler(buf, nil))),
+	)
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	client.Close()
+
+	if records := buf.records(t); len(records) == 0 {
+		t.Error("Expected log records to be written to the configured logger")
+	}
+}
+
+func TestLogger_NoAllocationWhenDisabled(t *testing.T) {
+	client := newTestClient(t, &fakeServer{})
+	client.logger = NewLogger(LogLevelInfo)
+	ctx := withOperation(context.Background(), opSub)
+	msg := NewMessage("orders", []byte("1"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		client.consumeError(ctx, msg, ErrSkipMessage)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocation for a debug line below the level, got %v", allocs)
+	}
+}
@@ -1,6 +1,8 @@
 package togomq
 
 import (
+	"fmt"
+
 	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
 )
 
@@ -18,6 +20,8 @@ type Message struct {
 	Retention int64
 	// UUID is the unique identifier of the message (for received messages)
 	UUID string
+	// Compression overrides the client compression for this message (for publishing)
+	Compression Compression
 }
 
 // NewMessage creates a new message with the given topic and body
@@ -47,6 +51,22 @@ func (m *Message) WithRetention(retention int64) *Message {
 	return m
 }
 
+// WithCompression sets the compression of the message body, regardless of the
+// client compression threshold. CompressionIdentity disables compression.
+func (m *Message) WithCompression(compression Compression) *Message {
+	m.Compression = compression
+	return m
+}
+
+// size returns the approximate encoded size of the message in bytes
+func (m *Message) size() int {
+	size := len(m.Topic) + len(m.Body)
+	for k, v := range m.Variables {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
 // toPubRequest converts a Message to a gRPC PubMessageRequest
 func (m *Message) toPubRequest() *mqv1.PubMessageRequest {
 	return &mqv1.PubMessageRequest{
@@ -76,6 +96,17 @@ type SubscribeOptions struct {
 	Batch int64
 	// SpeedPerSec limits the rate of message delivery per second (0 = unlimited)
 	SpeedPerSec int64
+	// Reconnect enables automatic re-opening of the stream after retryable failures (nil = disabled)
+	Reconnect *ReconnectOptions
+	// FlowControl adapts Batch and SpeedPerSec to the pace of the consumer (nil = disabled)
+	FlowControl *FlowControlOptions
+	// BufferSize is the number of messages prefetched in the message channel
+	// (0 = unbuffered, or the queue size of FlowControl)
+	BufferSize int
+	// Overflow is the behavior when the prefetch buffer is full (default: block)
+	Overflow OverflowPolicy
+	// SpillDir is the directory of the spill file of OverflowSpill (default: the temporary directory)
+	SpillDir string
 }
 
 // NewSubscribeOptions creates default subscribe options
@@ -99,6 +130,45 @@ func (s *SubscribeOptions) WithSpeedPerSec(speed int64) *SubscribeOptions {
 	return s
 }
 
+// WithReconnect enables the resilient mode that reconnects after retryable failures
+func (s *SubscribeOptions) WithReconnect(reconnect *ReconnectOptions) *SubscribeOptions {
+	s.Reconnect = reconnect
+	return s
+}
+
+// WithFlowControl enables the adaptive flow control of the subscription
+func (s *SubscribeOptions) WithFlowControl(flowControl *FlowControlOptions) *SubscribeOptions {
+	s.FlowControl = flowControl
+	return s
+}
+
+// WithBuffer sets the number of prefetched messages and the behavior when they fill the buffer
+func (s *SubscribeOptions) WithBuffer(size int, overflow OverflowPolicy) *SubscribeOptions {
+	s.BufferSize = size
+	s.Overflow = overflow
+	return s
+}
+
+// WithSpillDir sets the directory of the spill file of OverflowSpill
+func (s *SubscribeOptions) WithSpillDir(dir string) *SubscribeOptions {
+	s.SpillDir = dir
+	return s
+}
+
+// validateBuffer checks if the prefetch buffer options are valid
+func (s *SubscribeOptions) validateBuffer() error {
+	if s.BufferSize < 0 {
+		return fmt.Errorf("buffer size cannot be negative")
+	}
+	if err := s.Overflow.validate(); err != nil {
+		return err
+	}
+	if s.Overflow != "" && s.Overflow != OverflowBlock && s.BufferSize == 0 && s.FlowControl == nil {
+		return fmt.Errorf("overflow policy %s requires a buffer size", s.Overflow)
+	}
+	return nil
+}
+
 // toSubRequest converts SubscribeOptions to a gRPC SubMessageRequest
 func (s *SubscribeOptions) toSubRequest() *mqv1.SubMessageRequest {
 	return &mqv1.SubMessageRequest{
@@ -112,4 +182,45 @@ func (s *SubscribeOptions) toSubRequest() *mqv1.SubMessageRequest {
 type PubResponse struct {
 	// MessagesReceived is the number of messages successfully received by the server
 	MessagesReceived int64
+	// MessagesSent is the number of messages written to the stream before it completed or failed.
+	// Sent messages are only acknowledged by the server when the stream completes successfully.
+	MessagesSent int
+	// MessagesSkipped is the number of messages dropped by a publish middleware with ErrSkipMessage
+	MessagesSkipped int
+	// FirstUnsentIndex is the index of the first message that was not written to the stream
+	// (equal to the number of messages when all were sent)
+	FirstUnsentIndex int
+	// Unsent holds the messages that were never written to the stream when the publish failed
+	Unsent []*Message
+	// Uncertain holds the messages written to a stream that failed before the server acknowledged it.
+	// The server may or may not have stored them; they are included in MessagesSent.
+	Uncertain []*Message
+}
+
+// MatchTopic reports whether topic matches the pattern, where "*" matches any sequence of
+// characters: "*" matches every topic and "orders.*" matches "orders.created"
+func MatchTopic(pattern, topic string) bool {
+	// Only the last star is retried, matching one more character each time, which keeps the
+	// matching linear in practice and quadratic at worst
+	p, t := 0, 0
+	star, starT := -1, 0
+	for t < len(topic) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, starT = p, t
+			p++
+		case p < len(pattern) && pattern[p] == topic[t]:
+			p++
+			t++
+		case star >= 0:
+			starT++
+			p, t = star+1, starT
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
 }
@@ -1,7 +1,9 @@
 package togomq
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewMessage(t *testing.T) {
@@ -117,3 +119,49 @@ func TestSubscribeOptionsToSubRequest(t *testing.T) {
 		t.Errorf("Expected speed %d, got %d", opts.SpeedPerSec, req.SpeedPerSec)
 	}
 }
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders.created", false},
+		{"*", "orders.created", true},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders", false},
+		{"*.created", "orders.created", true},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.*.created", "orders.eu.deleted", false},
+		{"orders.**", "orders.", true},
+		{"*a*b", "xaxb", true},
+		{"*a*b", "xaxbx", false},
+		{"", "", true},
+		{"", "orders", false},
+		{"orders*", "orders", true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTopic_ManyStars(t *testing.T) {
+	// A recursive matcher backtracks exponentially on this pattern
+	pattern := strings.Repeat("*a", 30) + "b"
+	topic := strings.Repeat("a", 100)
+
+	done := make(chan bool)
+	go func() { done <- MatchTopic(pattern, topic) }()
+	select {
+	case matched := <-done:
+		if matched {
+			t.Error("Expected no match")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("MatchTopic did not complete in time")
+	}
+}
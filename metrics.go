@@ -0,0 +1,101 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metrics receives measurements of the SDK, e.g. to export them to a monitoring system.
+// Implementations must be safe for concurrent use. Embed NoopMetrics to implement only
+// some of the methods. Measurements added later are reported through optional interfaces,
+// such as RateLimitMetrics and FlowControlMetrics, that a Metrics may also implement.
+type Metrics interface {
+	// MessagePublished is called for every message sent on a publish stream,
+	// with the size of the request on the wire
+	MessagePublished(topic string, bytes int)
+	// MessageReceived is called for every message received on a subscribe stream,
+	// with the size of the response on the wire
+	MessageReceived(topic string, bytes int)
+	// PublishLatency is called when a publish stream completes, with the time from
+	// opening the stream to the server acknowledgement or the failure
+	PublishLatency(operation string, d time.Duration)
+	// Error is called for every failed call to the server, with the ErrCode* of the error
+	Error(operation string, code string)
+	// SubscriptionStarted is called when a subscribe stream is started
+	SubscriptionStarted(topic string)
+	// SubscriptionStopped is called when a subscribe stream is stopped for good
+	SubscriptionStopped(topic string)
+	// Reconnect is called for every attempt to re-open a lost subscription
+	Reconnect(topic string)
+}
+
+// RateLimitMetrics is implemented by a Metrics that records the rate limiting of publishes
+type RateLimitMetrics interface {
+	// RateLimited is called for every message that exceeds a publish rate limit,
+	// with the RateLimitMode applied to it
+	RateLimited(topic string, mode string)
+}
+
+// FlowControlMetrics is implemented by a Metrics that records the flow control of subscriptions
+type FlowControlMetrics interface {
+	// SubscriptionRate is called periodically for subscriptions with flow control,
+	// with the number of messages per second delivered to the consumer
+	SubscriptionRate(topic string, messagesPerSec float64)
+}
+
+// NoopMetrics is a Metrics that discards all measurements
+type NoopMetrics struct{}
+
+// MessagePublished does nothing
+func (NoopMetrics) MessagePublished(topic string, bytes int) {}
+
+// MessageReceived does nothing
+func (NoopMetrics) MessageReceived(topic string, bytes int) {}
+
+// PublishLatency does nothing
+func (NoopMetrics) PublishLatency(operation string, d time.Duration) {}
+
+// Error does nothing
+func (NoopMetrics) Error(operation string, code string) {}
+
+// SubscriptionStarted does nothing
+func (NoopMetrics) SubscriptionStarted(topic string) {}
+
+// SubscriptionStopped does nothing
+func (NoopMetrics) SubscriptionStopped(topic string) {}
+
+// Reconnect does nothing
+func (NoopMetrics) Reconnect(topic string) {}
+
+// metrics returns the configured metrics, or NoopMetrics when none is set
+func (c *Client) metrics() Metrics {
+	if c.config.Metrics == nil {
+		return NoopMetrics{}
+	}
+	return c.config.Metrics
+}
+
+// rateLimited records a rate limited message if the metrics implement RateLimitMetrics
+func (c *Client) rateLimited(topic string, mode RateLimitMode) {
+	if m, ok := c.metrics().(RateLimitMetrics); ok {
+		m.RateLimited(topic, string(mode))
+	}
+}
+
+// subscriptionRate records the delivery rate of a subscription if the metrics implement FlowControlMetrics
+func (c *Client) subscriptionRate(topic string, messagesPerSec float64) {
+	if m, ok := c.metrics().(FlowControlMetrics); ok {
+		m.SubscriptionRate(topic, messagesPerSec)
+	}
+}
+
+// wrapError wraps a gRPC error with WrapGRPCError and records its code
+func (c *Client) wrapError(ctx context.Context, err error, message string) error {
+	wrapped := WrapGRPCError(err, message)
+	var tmqErr *TogoMQError
+	if errors.As(wrapped, &tmqErr) {
+		c.metrics().Error(operation(ctx), string(tmqErr.Code))
+	}
+	return wrapped
+}
@@ -0,0 +1,204 @@
+package togomq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recordingMetrics records the measurements it receives
+type recordingMetrics struct {
+	NoopMetrics
+
+	mu            sync.Mutex
+	published     map[string]int
+	received      map[string]int
+	bytesSent     int
+	latencies     []string
+	errors        []string
+	subscriptions int
+	reconnects    int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		published: make(map[string]int),
+		received:  make(map[string]int),
+	}
+}
+
+func (m *recordingMetrics) MessagePublished(topic string, bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published[topic]++
+	m.bytesSent += bytes
+}
+
+func (m *recordingMetrics) MessageReceived(topic string, bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received[topic]++
+}
+
+func (m *recordingMetrics) PublishLatency(operation string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies = append(m.latencies, operation)
+}
+
+func (m *recordingMetrics) Error(operation string, code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, operation+"/"+code)
+}
+
+func (m *recordingMetrics) SubscriptionStarted(topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions++
+}
+
+func (m *recordingMetrics) SubscriptionStopped(topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions--
+}
+
+func (m *recordingMetrics) Reconnect(topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects++
+}
+
+func TestMetrics_PubBatch(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+	metrics := newRecordingMetrics()
+	client.config.Metrics = metrics
+
+	messages := []*Message{
+		NewMessage("orders", []byte("a")),
+		NewMessage("orders", []byte("b")),
+		NewMessage("events", []byte("c")),
+	}
+	if _, err := client.PubBatch(context.Background(), messages); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.published["orders"] != 2 || metrics.published["events"] != 1 {
+		t.Errorf("Expected 2 orders and 1 events published, got %v", metrics.published)
+	}
+	if metrics.bytesSent == 0 {
+		t.Error("Expected bytes sent to be recorded")
+	}
+	if len(metrics.latencies) != 1 || metrics.latencies[0] != opPubBatch {
+		t.Errorf("Expected 1 PubBatch latency, got %v", metrics.latencies)
+	}
+	if len(metrics.errors) != 0 {
+		t.Errorf("Expected no errors, got %v", metrics.errors)
+	}
+}
+
+func TestMetrics_SubReconnect(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: "1", Body: []byte("body")})
+			if call == 1 {
+				return status.Error(codes.Unavailable, "server restarting")
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	metrics := newRecordingMetrics()
+	client.config.Metrics = metrics
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("orders").WithReconnect(fastReconnect()))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	<-msgChan
+	<-msgChan
+
+	metrics.mu.Lock()
+	if metrics.subscriptions != 1 {
+		t.Errorf("Expected 1 active subscription, got %d", metrics.subscriptions)
+	}
+	if metrics.received["orders"] != 2 {
+		t.Errorf("Expected 2 messages received, got %v", metrics.received)
+	}
+	if metrics.reconnects != 1 {
+		t.Errorf("Expected 1 reconnect, got %d", metrics.reconnects)
+	}
+	if len(metrics.errors) != 1 || metrics.errors[0] != opSub+"/"+string(ErrCodeConnection) {
+		t.Errorf("Expected 1 connection error, got %v", metrics.errors)
+	}
+	metrics.mu.Unlock()
+
+	// The subscription is stopped once the channels are closed
+	cancel()
+	for range msgChan {
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.subscriptions != 0 {
+		t.Errorf("Expected no active subscription, got %d", metrics.subscriptions)
+	}
+}
+
+func TestMetrics_CountMessagesError(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			return nil, status.Error(codes.Unauthenticated, "bad token")
+		},
+	}
+	client := newTestClient(t, srv)
+	metrics := newRecordingMetrics()
+	client.config.Metrics = metrics
+
+	if _, err := client.CountMessages(context.Background(), "orders"); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.errors) != 1 || metrics.errors[0] != opCountMessages+"/"+string(ErrCodeAuth) {
+		t.Errorf("Expected 1 auth error, got %v", metrics.errors)
+	}
+}
+
+func TestMetrics_OptionalInterfaces(t *testing.T) {
+	client := newTestClient(t, &fakeServer{})
+
+	// Metrics that only implement the Metrics interface do not receive the optional measurements
+	client.config.Metrics = newRecordingMetrics()
+	client.rateLimited("orders", RateLimitShed)
+	client.subscriptionRate("orders", 10)
+
+	limited := &rateLimitedMetrics{}
+	client.config.Metrics = limited
+	client.rateLimited("orders", RateLimitShed)
+	if len(limited.limited) != 1 || limited.limited[0] != "orders/shed" {
+		t.Errorf("Expected the rate limited message to be recorded, got %v", limited.limited)
+	}
+
+	rates := &rateMetrics{}
+	client.config.Metrics = rates
+	client.subscriptionRate("orders", 10)
+	if len(rates.rates) != 1 || rates.rates[0] != 10 {
+		t.Errorf("Expected the subscription rate to be recorded, got %v", rates.rates)
+	}
+}
@@ -0,0 +1,60 @@
+package togomq
+
+import (
+	"errors"
+)
+
+// ErrSkipMessage can be returned by a middleware to drop a message silently.
+// Skipped messages are neither published nor delivered, and no error is reported.
+var ErrSkipMessage = errors.New("togomq: skip message")
+
+// PublishMiddleware wraps the handler that sends a message on the publish stream.
+// It runs before the message is converted to a request and may modify the message,
+// or reject it by returning an error, which aborts the publish.
+type PublishMiddleware func(next Handler) Handler
+
+// ConsumeMiddleware wraps the handler that delivers a received message to the subscriber.
+// It runs after the message is converted from the response and may modify the message,
+// or reject it by returning an error, which drops the message.
+type ConsumeMiddleware func(next Handler) Handler
+
+// chain composes middleware around final; the first middleware is the outermost
+func chain[M ~func(Handler) Handler](middleware []M, final Handler) Handler {
+	h := final
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// publishMiddleware returns the configured publish middleware followed by the built-in ones
+func (c *Client) publishMiddleware() []PublishMiddleware {
+	middleware := append([]PublishMiddleware{}, c.config.PublishMiddleware...)
+	if c.tracingEnabled() {
+		middleware = append(middleware, c.tracePublish)
+	}
+	middleware = append(middleware, c.compressPublish)
+	if c.config.Encryption != nil {
+		middleware = append(middleware, c.encryptPublish)
+	}
+	if c.config.Signing != nil && c.config.Signing.Key != nil {
+		middleware = append(middleware, c.signPublish)
+	}
+	if c.config.RateLimit != nil || len(c.config.TopicRateLimits) > 0 {
+		middleware = append(middleware, c.rateLimitPublish)
+	}
+	return middleware
+}
+
+// consumeMiddleware returns the built-in consume middleware followed by the configured ones
+func (c *Client) consumeMiddleware() []ConsumeMiddleware {
+	var middleware []ConsumeMiddleware
+	if c.config.Signing != nil && len(c.config.Signing.VerifyKeys) > 0 {
+		middleware = append(middleware, c.verifyConsume)
+	}
+	middleware = append(middleware, c.decryptConsume, c.decompressConsume)
+	if c.tracingEnabled() {
+		middleware = append(middleware, c.traceConsume)
+	}
+	return append(middleware, c.config.ConsumeMiddleware...)
+}
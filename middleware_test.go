@@ -0,0 +1,190 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	middleware := func(name string) PublishMiddleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, msg *Message) error {
+				calls = append(calls, name)
+				return next.Handle(ctx, msg)
+			})
+		}
+	}
+
+	final := HandlerFunc(func(ctx context.Context, msg *Message) error {
+		calls = append(calls, "final")
+		return nil
+	})
+
+	h := chain([]PublishMiddleware{middleware("first"), middleware("second")}, final)
+	if err := h.Handle(context.Background(), NewMessage("orders", nil)); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	if got := strings.Join(calls, ","); got != "first,second,final" {
+		t.Errorf("Expected call order first,second,final, got %s", got)
+	}
+}
+
+func TestPublishMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+
+	enrich := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *Message) error {
+			msg.Variables["source"] = "billing"
+			return next.Handle(ctx, msg)
+		})
+	}
+	skipDebug := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *Message) error {
+			if msg.Topic == "debug" {
+				return ErrSkipMessage
+			}
+			return next.Handle(ctx, msg)
+		})
+	}
+	client.config.PublishMiddleware = []PublishMiddleware{enrich, skipDebug}
+
+	resp, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("orders", []byte("1")),
+		NewMessage("debug", []byte("2")),
+		NewMessage("orders", []byte("3")),
+	})
+	if err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if resp.MessagesSent != 2 || resp.MessagesSkipped != 1 {
+		t.Errorf("Expected 2 sent and 1 skipped, got %d sent and %d skipped", resp.MessagesSent, resp.MessagesSkipped)
+	}
+	if resp.FirstUnsentIndex != 3 {
+		t.Errorf("Expected first unsent index 3, got %d", resp.FirstUnsentIndex)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 messages received by server, got %d", len(received))
+	}
+	for _, req := range received {
+		if req.Variables["source"] != "billing" {
+			t.Errorf("Expected enriched variable, got %v", req.Variables)
+		}
+	}
+}
+
+func TestPublishMiddleware_Reject(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+
+	errTooLarge := errors.New("message too large")
+	client.config.PublishMiddleware = []PublishMiddleware{
+		func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, msg *Message) error {
+				if len(msg.Body) > 3 {
+					return errTooLarge
+				}
+				return next.Handle(ctx, msg)
+			})
+		},
+	}
+
+	messages := []*Message{
+		NewMessage("orders", []byte("1")),
+		NewMessage("orders", []byte("too large")),
+	}
+	resp, err := client.PubBatch(context.Background(), messages)
+
+	tmqErr, ok := err.(*TogoMQError)
+	if !ok || tmqErr.Code != ErrCodePublish {
+		t.Fatalf("Expected %s error, got %v", ErrCodePublish, err)
+	}
+	if !errors.Is(err, errTooLarge) {
+		t.Errorf("Expected error to wrap the middleware error, got %v", err)
+	}
+	if len(resp.Unsent) != 1 || resp.Unsent[0] != messages[1] {
+		t.Errorf("Expected the rejected message to be unsent, got %v", resp.Unsent)
+	}
+}
+
+func TestPublishMiddleware_RejectWrapped(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+
+	client.config.PublishMiddleware = []PublishMiddleware{
+		func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, msg *Message) error {
+				return fmt.Errorf("quota check: %w", NewError(ErrCodeRateLimit, "quota exceeded", nil))
+			})
+		},
+	}
+
+	_, err := client.PubBatch(context.Background(), []*Message{NewMessage("orders", []byte("1"))})
+
+	var tmqErr *TogoMQError
+	if !errors.As(err, &tmqErr) || tmqErr.Code != ErrCodeRateLimit {
+		t.Fatalf("Expected the wrapped %s error to be kept, got %v", ErrCodeRateLimit, err)
+	}
+}
+
+func TestConsumeMiddleware(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(4))
+
+	redact := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *Message) error {
+			msg.Body = []byte("[redacted]")
+			return next.Handle(ctx, msg)
+		})
+	}
+	errInvalid := errors.New("invalid message")
+	reject := func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *Message) error {
+			switch msg.UUID {
+			case "1":
+				return ErrSkipMessage
+			case "2":
+				return errInvalid
+			}
+			return next.Handle(ctx, msg)
+		})
+	}
+
+	var rejected []error
+	client.config.ConsumeMiddleware = []ConsumeMiddleware{reject, redact}
+	client.config.ConsumeErrorHandler = func(msg *Message, err error) {
+		rejected = append(rejected, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	for _, expected := range []string{"0", "3"} {
+		msg := <-msgChan
+		if msg == nil || msg.UUID != expected {
+			t.Fatalf("Expected message %s, got %+v", expected, msg)
+		}
+		if string(msg.Body) != "[redacted]" {
+			t.Errorf("Expected redacted body, got %s", msg.Body)
+		}
+	}
+
+	if len(rejected) != 1 || !errors.Is(rejected[0], errInvalid) {
+		t.Errorf("Expected 1 rejected message, got %v", rejected)
+	}
+}
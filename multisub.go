@@ -0,0 +1,101 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SubscriptionError is an error of one of the subscriptions of SubMulti, tagged with its topic pattern
+type SubscriptionError struct {
+	// Topic is the topic pattern of the failed subscription
+	Topic string
+	// Err is the error of the subscription
+	Err error
+}
+
+// Error implements the error interface
+func (e *SubscriptionError) Error() string {
+	return fmt.Sprintf("subscription %s: %v", e.Topic, e.Err)
+}
+
+// Unwrap returns the error of the subscription
+func (e *SubscriptionError) Unwrap() error {
+	return e.Err
+}
+
+// SubMulti subscribes to several topic patterns, each with its own options, and merges their
+// messages into one channel. Every subscription runs on its own stream: a failed one sends a
+// SubscriptionError on the error channel and ends without stopping the others.
+// Both channels are closed when all subscriptions have ended or ctx is cancelled.
+// If a subscription fails to start, the started ones are stopped and its SubscriptionError is returned.
+func (c *Client) SubMulti(ctx context.Context, opts []*SubscribeOptions) (<-chan *Message, <-chan error, error) {
+	if len(opts) == 0 {
+		return nil, nil, NewError(ErrCodeValidation, "at least one subscription is required", nil)
+	}
+	topics := make(map[string]bool, len(opts))
+	for _, o := range opts {
+		if o == nil {
+			return nil, nil, NewError(ErrCodeValidation, "subscribe options cannot be nil", nil)
+		}
+		if topics[o.Topic] {
+			return nil, nil, NewError(ErrCodeValidation, fmt.Sprintf("duplicate subscription to topic %s", o.Topic), nil)
+		}
+		topics[o.Topic] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	messages := make([]<-chan *Message, len(opts))
+	errs := make([]<-chan error, len(opts))
+	for i, o := range opts {
+		var err error
+		if messages[i], errs[i], err = c.Sub(ctx, o); err != nil {
+			cancel()
+			return nil, nil, &SubscriptionError{Topic: o.Topic, Err: err}
+		}
+	}
+
+	messageChan := make(chan *Message)
+	errorChan := make(chan error, len(opts))
+	c.buffers.Store((<-chan *Message)(messageChan), func() BufferStats {
+		var total BufferStats
+		for _, m := range messages {
+			stats, _ := c.BufferStats(m)
+			total.Size += stats.Size
+			total.Buffered += stats.Buffered
+			total.Spilled += stats.Spilled
+			total.Dropped += stats.Dropped
+		}
+		return total
+	})
+
+	var wg sync.WaitGroup
+	for i, o := range opts {
+		wg.Add(1)
+		go func(topic string, messages <-chan *Message, errs <-chan error) {
+			defer wg.Done()
+			for msg := range messages {
+				select {
+				case messageChan <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// A cancelled SubMulti stops all subscriptions, which is not an error of one of them
+			if err, ok := <-errs; ok && err != nil && ctx.Err() == nil {
+				c.log(ctx).WithError(err).With(LogKeyTopic, topic).Warn("Subscription of SubMulti ended")
+				errorChan <- &SubscriptionError{Topic: topic, Err: err}
+			}
+		}(o.Topic, messages[i], errs[i])
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		c.buffers.Delete((<-chan *Message)(messageChan))
+		close(messageChan)
+		close(errorChan)
+	}()
+
+	return messageChan, errorChan, nil
+}
@@ -0,0 +1,125 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// multiSubServer streams three messages per topic and fails the topic "payments.refund"
+func multiSubServer(requests chan<- *mqv1.SubMessageRequest) *fakeServer {
+	return &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			requests <- req
+			for i := 0; i < 3; i++ {
+				if err := stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: fmt.Sprintf("%s-%d", req.Topic, i)}); err != nil {
+					return err
+				}
+			}
+			if req.Topic == "payments.refund" {
+				return status.Error(codes.PermissionDenied, "topic is not readable")
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+}
+
+func TestSubMulti(t *testing.T) {
+	requests := make(chan *mqv1.SubMessageRequest, 2)
+	client := newTestClient(t, multiSubServer(requests))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgChan, errChan, err := client.SubMulti(ctx, []*SubscribeOptions{
+		NewSubscribeOptions("orders.*").WithBatch(10).WithSpeedPerSec(100),
+		NewSubscribeOptions("payments.refund").WithBatch(5),
+	})
+	if err != nil {
+		t.Fatalf("SubMulti failed: %v", err)
+	}
+
+	// Every topic has its own stream and options
+	byTopic := map[string]*mqv1.SubMessageRequest{}
+	for i := 0; i < 2; i++ {
+		req := <-requests
+		byTopic[req.Topic] = req
+	}
+	if byTopic["orders.*"].Batch != 10 || byTopic["orders.*"].SpeedPerSec != 100 || byTopic["payments.refund"].Batch != 5 {
+		t.Errorf("Unexpected requests %v", byTopic)
+	}
+
+	var uuids []string
+	for len(uuids) < 6 {
+		select {
+		case msg := <-msgChan:
+			uuids = append(uuids, msg.UUID)
+		case <-ctx.Done():
+			t.Fatalf("Timed out after %v", uuids)
+		}
+	}
+	sort.Strings(uuids)
+	if fmt.Sprint(uuids) != "[orders.*-0 orders.*-1 orders.*-2 payments.refund-0 payments.refund-1 payments.refund-2]" {
+		t.Errorf("Expected the messages of both topics, got %v", uuids)
+	}
+
+	// The failed subscription is reported with its topic
+	select {
+	case err := <-errChan:
+		var subErr *SubscriptionError
+		if !errors.As(err, &subErr) || subErr.Topic != "payments.refund" || !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected a permission error of payments.refund, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the error")
+	}
+
+	// The other subscription keeps running until the context is cancelled
+	if _, ok := client.BufferStats(msgChan); !ok {
+		t.Error("Expected the merged subscription to be running")
+	}
+	cancel()
+	for range msgChan {
+	}
+	if _, ok := <-errChan; ok {
+		t.Error("Expected the error channel to be closed")
+	}
+}
+
+func TestSubMulti_Validation(t *testing.T) {
+	client := newTestClient(t, streamingSubServer(0))
+	tests := []struct {
+		name string
+		opts []*SubscribeOptions
+		want string
+	}{
+		{"empty", nil, "at least one subscription"},
+		{"nil options", []*SubscribeOptions{nil}, "cannot be nil"},
+		{"duplicate", []*SubscribeOptions{NewSubscribeOptions("orders"), NewSubscribeOptions("orders")}, "duplicate subscription"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := client.SubMulti(context.Background(), tt.opts)
+			if decodeErrCode(err) != ErrCodeValidation {
+				t.Errorf("Expected a validation error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// A subscription that cannot start is reported with its topic
+	_, _, err := client.SubMulti(context.Background(), []*SubscribeOptions{
+		NewSubscribeOptions("orders"),
+		NewSubscribeOptions(""),
+	})
+	var subErr *SubscriptionError
+	if !errors.As(err, &subErr) || subErr.Topic != "" || decodeErrCode(err) != ErrCodeValidation {
+		t.Errorf("Expected a SubscriptionError, got %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package togomq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PublisherOptions configures the batching behavior of a Publisher
+type PublisherOptions struct {
+	// BatchSize is the number of messages that triggers sending a batch (default: 100)
+	BatchSize int
+	// BatchBytes is the approximate batch size in bytes that triggers sending a batch (default: 1MB)
+	BatchBytes int
+	// Linger is the maximum time a message waits for its batch to fill up (default: 10ms)
+	Linger time.Duration
+	// QueueSize is the maximum number of messages waiting to be sent (default: 10000)
+	QueueSize int
+}
+
+// DefaultPublisherOptions returns PublisherOptions with default values
+func DefaultPublisherOptions() *PublisherOptions {
+	return &PublisherOptions{
+		BatchSize:  100,
+		BatchBytes: 1024 * 1024,           // 1MB
+		Linger:     10 * time.Millisecond, // 10ms
+		QueueSize:  10000,
+	}
+}
+
+// WithBatchSize sets the number of messages per batch
+func (o *PublisherOptions) WithBatchSize(size int) *PublisherOptions {
+	o.BatchSize = size
+	return o
+}
+
+// WithBatchBytes sets the approximate number of bytes per batch
+func (o *PublisherOptions) WithBatchBytes(size int) *PublisherOptions {
+	o.BatchBytes = size
+	return o
+}
+
+// WithLinger sets the maximum time a message waits for its batch to fill up
+func (o *PublisherOptions) WithLinger(linger time.Duration) *PublisherOptions {
+	o.Linger = linger
+	return o
+}
+
+// WithQueueSize sets the maximum number of messages waiting to be sent
+func (o *PublisherOptions) WithQueueSize(size int) *PublisherOptions {
+	o.QueueSize = size
+	return o
+}
+
+// Publisher publishes messages asynchronously over a long-lived publish stream.
+// Messages are batched by count, size and linger time in a background goroutine.
+// The server acknowledges the messages of a stream when it is flushed.
+// A Publisher is safe for concurrent use.
+type Publisher struct {
+	client *Client
+	opts   PublisherOptions
+
+	mu     sync.RWMutex
+	closed bool
+
+	queue   chan *Message
+	flushCh chan chan flushResult
+	done    chan struct{}
+
+	// The fields below are owned by the background goroutine
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stream       mqv1.MqService_PubMessageClient
+	streamCancel context.CancelFunc
+	streamSpan   trace.Span
+	streamStart  time.Time
+	publish      Handler
+	written      []*Message // messages written to the current stream
+	err          error
+	result       PubResponse // progress since the last flush
+}
+
+// flushResult is the outcome of a flush performed by the background goroutine
+type flushResult struct {
+	resp *PubResponse
+	err  error
+}
+
+// NewPublisher creates a Publisher that publishes through the client.
+// A nil opts uses DefaultPublisherOptions.
+func (c *Client) NewPublisher(opts *PublisherOptions) *Publisher {
+	defaults := DefaultPublisherOptions()
+	if opts == nil {
+		opts = defaults
+	}
+
+	p := &Publisher{
+		client:  c,
+		opts:    *opts,
+		flushCh: make(chan chan flushResult),
+		done:    make(chan struct{}),
+	}
+	if p.opts.BatchSize <= 0 {
+		p.opts.BatchSize = defaults.BatchSize
+	}
+	if p.opts.BatchBytes <= 0 {
+		p.opts.BatchBytes = defaults.BatchBytes
+	}
+	if p.opts.Linger <= 0 {
+		p.opts.Linger = defaults.Linger
+	}
+	if p.opts.QueueSize <= 0 {
+		p.opts.QueueSize = defaults.QueueSize
+	}
+	p.queue = make(chan *Message, p.opts.QueueSize)
+	p.ctx, p.cancel = context.WithCancel(withOperation(context.Background(), opPublisher))
+
+	go p.run()
+
+	return p
+}
+
+// Publish queues a message for publishing and returns without waiting for it to be sent.
+// It fails if the message has no topic, the queue is full or the publisher is closed.
+func (p *Publisher) Publish(msg *Message) error {
+	if msg.Topic == "" {
+		return NewError(ErrCodeValidation, "message topic is required", nil)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return NewError(ErrCodePublish, "publisher is closed", nil)
+	}
+
+	select {
+	case p.queue <- msg:
+		return nil
+	default:
+		return NewError(ErrCodePublish, "publisher queue is full", nil)
+	}
+}
+
+// Flush sends all queued messages, closes the current stream and waits for the server
+// to acknowledge it. The response holds the number of messages acknowledged by the server.
+// If a send failed since the last flush, the error is returned and the response reports the
+// messages that were never sent; FirstUnsentIndex counts in publish order since the last flush.
+// Messages written to a stream that failed before it was acknowledged are reported as Uncertain.
+func (p *Publisher) Flush(ctx context.Context) (*PubResponse, error) {
+	result := make(chan flushResult, 1)
+
+	select {
+	case p.flushCh <- result:
+	case <-p.done:
+		return nil, NewError(ErrCodePublish, "publisher is closed", nil)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case r := <-result:
+		return r.resp, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops accepting messages, flushes the queued ones and stops the publisher.
+// If ctx is done before the flush completes, pending messages are abandoned.
+func (p *Publisher) Close(ctx context.Context) (*PubResponse, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, NewError(ErrCodePublish, "publisher is closed", nil)
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	resp, err := p.Flush(ctx)
+	p.cancel()
+	<-p.done
+
+	return resp, err
+}
+
+// run batches queued messages and sends them on the stream until the publisher is closed
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	var batch []*Message
+	batchBytes := 0
+	var timer *time.Timer
+	var lingerC <-chan time.Time
+
+	sendBatch := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, lingerC = nil, nil
+		}
+		p.sendBatch(batch)
+		batch, batchBytes = nil, 0
+	}
+
+	for {
+		select {
+		case msg := <-p.queue:
+			batch = append(batch, msg)
+			batchBytes += msg.size()
+			if len(batch) >= p.opts.BatchSize || batchBytes >= p.opts.BatchBytes {
+				sendBatch()
+			} else if timer == nil {
+				timer = time.NewTimer(p.opts.Linger)
+				lingerC = timer.C
+			}
+
+		case <-lingerC:
+			timer, lingerC = nil, nil
+			sendBatch()
+
+		case result := <-p.flushCh:
+			// Include every message queued before the flush was requested
+			for drained := false; !drained; {
+				select {
+				case msg := <-p.queue:
+					batch = append(batch, msg)
+				default:
+					drained = true
+				}
+			}
+			sendBatch()
+			resp, err := p.closeStream()
+			result <- flushResult{resp: resp, err: err}
+
+		case <-p.ctx.Done():
+			p.abortStream()
+			return
+		}
+	}
+}
+
+// sendBatch sends the messages on the current stream, opening one if needed
+func (p *Publisher) sendBatch(batch []*Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if p.stream == nil {
+		streamCtx, cancel := context.WithCancel(p.ctx)
+		streamCtx, span := p.client.startPublishSpan(streamCtx)
+		stream, err := p.client.openPubStream(streamCtx)
+		if err != nil {
+			endSpan(span, err)
+			cancel()
+			p.fail(err, batch)
+			return
+		}
+		p.stream, p.streamCancel, p.streamSpan = stream, cancel, span
+		p.streamStart = time.Now()
+		p.publish = p.client.publishHandler(stream)
+	}
+
+	for i, msg := range batch {
+		skipped, err := p.client.sendMessage(p.stream.Context(), p.publish, msg)
+		if err != nil {
+			p.fail(err, batch[i:])
+			p.abortStream()
+			return
+		}
+		if skipped {
+			p.result.MessagesSkipped++
+		} else {
+			p.result.MessagesSent++
+			p.written = append(p.written, msg)
+		}
+		if len(p.result.Unsent) == 0 {
+			p.result.FirstUnsentIndex++
+		}
+	}
+	p.client.log(p.ctx).With(LogKeyCount, len(batch)).Debug("Sent batch")
+}
+
+// fail records a send error and the messages that were not sent because of it
+func (p *Publisher) fail(err error, unsent []*Message) {
+	if p.err == nil {
+		p.err = err
+	}
+	p.result.Unsent = append(p.result.Unsent, unsent...)
+}
+
+// closeStream closes the current stream and waits for the server acknowledgement
+func (p *Publisher) closeStream() (*PubResponse, error) {
+	resp := &PubResponse{
+		MessagesSent:     p.result.MessagesSent,
+		MessagesSkipped:  p.result.MessagesSkipped,
+		FirstUnsentIndex: p.result.FirstUnsentIndex,
+		Unsent:           p.result.Unsent,
+		Uncertain:        p.result.Uncertain,
+	}
+	err := p.err
+	p.err = nil
+	p.result = PubResponse{}
+
+	if p.stream != nil {
+		ack, recvErr := p.stream.CloseAndRecv()
+		p.streamCancel()
+		p.stream, p.streamCancel = nil, nil
+
+		if recvErr != nil {
+			resp.Uncertain = append(resp.Uncertain, p.written...)
+			p.client.log(p.ctx).WithError(recvErr).Error("Failed to receive pub response")
+			if err == nil {
+				err = p.client.wrapError(p.ctx, recvErr, "failed to receive publish response")
+			}
+		} else {
+			resp.MessagesReceived = ack.MessagesReceived
+			p.client.log(p.ctx).With(LogKeyCount, ack.MessagesReceived).Info("Flushed, messages received by server")
+		}
+		p.client.metrics().PublishLatency(opPublisher, time.Since(p.streamStart))
+		endPublishSpan(p.streamSpan, resp, err)
+		p.streamSpan = nil
+		p.written = nil
+	}
+
+	return resp, err
+}
+
+// abortStream cancels the current stream without waiting for an acknowledgement.
+// The messages written to it become uncertain.
+func (p *Publisher) abortStream() {
+	if p.stream != nil {
+		p.result.Uncertain = append(p.result.Uncertain, p.written...)
+		p.written = nil
+		p.streamCancel()
+		p.client.metrics().PublishLatency(opPublisher, time.Since(p.streamStart))
+		endSpan(p.streamSpan, p.err)
+		p.stream, p.streamCancel, p.streamSpan = nil, nil, nil
+	}
+}
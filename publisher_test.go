@@ -0,0 +1,224 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recordingPubServer returns a fakeServer that records published messages and acknowledges them
+func recordingPubServer(mu *sync.Mutex, received *[]*mqv1.PubMessageRequest) *fakeServer {
+	return &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			var count int64
+			for {
+				req, err := stream.Recv()
+				if err == io.EOF {
+					return stream.SendAndClose(&mqv1.PubMessageResponse{MessagesReceived: count})
+				}
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				*received = append(*received, req)
+				mu.Unlock()
+				count++
+			}
+		},
+	}
+}
+
+func TestPublisher_Flush(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	srv := recordingPubServer(&mu, &received)
+	client := newTestClient(t, srv)
+
+	publisher := client.NewPublisher(DefaultPublisherOptions().WithLinger(time.Hour))
+
+	for i := 0; i < 5; i++ {
+		if err := publisher.Publish(NewMessage("orders", []byte("order"))); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	resp, err := publisher.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if resp.MessagesReceived != 5 {
+		t.Errorf("Expected 5 messages acknowledged, got %d", resp.MessagesReceived)
+	}
+
+	if err := publisher.Publish(NewMessage("orders", []byte("order"))); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	resp, err = publisher.Close(context.Background())
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if resp.MessagesReceived != 1 {
+		t.Errorf("Expected 1 message acknowledged on close, got %d", resp.MessagesReceived)
+	}
+
+	if _, pub := srv.calls(); pub != 2 {
+		t.Errorf("Expected 2 publish streams, got %d", pub)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 6 {
+		t.Errorf("Expected 6 messages received by server, got %d", len(received))
+	}
+}
+
+func TestPublisher_BatchTriggers(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *PublisherOptions
+	}{
+		{"batch size", DefaultPublisherOptions().WithBatchSize(3).WithLinger(time.Hour)},
+		{"batch bytes", DefaultPublisherOptions().WithBatchBytes(48).WithLinger(time.Hour)},
+		{"linger", DefaultPublisherOptions().WithLinger(5 * time.Millisecond)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var received []*mqv1.PubMessageRequest
+			client := newTestClient(t, recordingPubServer(&mu, &received))
+
+			publisher := client.NewPublisher(tt.opts)
+			defer publisher.Close(context.Background())
+
+			for i := 0; i < 3; i++ {
+				publisher.Publish(NewMessage("orders", []byte("0123456789")))
+			}
+
+			// The batch is sent on the open stream before any flush
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mu.Lock()
+				n := len(received)
+				mu.Unlock()
+				if n == 3 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected 3 messages sent before flush, got %d", n)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestPublisher_Validation(t *testing.T) {
+	client := newTestClient(t, &fakeServer{})
+	publisher := client.NewPublisher(nil)
+
+	err := publisher.Publish(&Message{Body: []byte("no topic")})
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodeValidation {
+		t.Errorf("Expected %s error, got %v", ErrCodeValidation, err)
+	}
+
+	if _, err := publisher.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	err = publisher.Publish(NewMessage("orders", nil))
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodePublish {
+		t.Errorf("Expected %s error after close, got %v", ErrCodePublish, err)
+	}
+	if _, err := publisher.Flush(context.Background()); err == nil {
+		t.Error("Expected error flushing a closed publisher, got nil")
+	}
+}
+
+func TestPublisher_QueueFull(t *testing.T) {
+	client := newTestClient(t, &fakeServer{})
+	publisher := &Publisher{
+		client: client,
+		queue:  make(chan *Message, 1),
+	}
+
+	if err := publisher.Publish(NewMessage("orders", nil)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	err := publisher.Publish(NewMessage("orders", nil))
+	if tmqErr, ok := err.(*TogoMQError); !ok || tmqErr.Code != ErrCodePublish {
+		t.Errorf("Expected %s error for full queue, got %v", ErrCodePublish, err)
+	}
+}
+
+func TestPublisher_FlushReportsUnsent(t *testing.T) {
+	srv := &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			return status.Error(codes.Unavailable, "down")
+		},
+	}
+	client := newTestClient(t, srv)
+	publisher := client.NewPublisher(DefaultPublisherOptions().WithLinger(time.Hour))
+	defer publisher.Close(context.Background())
+
+	for i := 0; i < 3; i++ {
+		publisher.Publish(NewMessage("orders", make([]byte, 64*1024)))
+	}
+
+	resp, err := publisher.Flush(context.Background())
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if resp.MessagesReceived != 0 {
+		t.Errorf("Expected no messages acknowledged, got %d", resp.MessagesReceived)
+	}
+	if resp.MessagesSent+len(resp.Unsent) != 3 {
+		t.Errorf("Expected sent and unsent messages to add up to 3, got %d + %d", resp.MessagesSent, len(resp.Unsent))
+	}
+}
+
+func TestPublisher_FlushReportsUncertain(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+	client.config.PublishMiddleware = []PublishMiddleware{func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *Message) error {
+			if msg.UUID == "2" {
+				return NewError(ErrCodeValidation, "rejected", nil)
+			}
+			return next.Handle(ctx, msg)
+		})
+	}}
+	publisher := client.NewPublisher(DefaultPublisherOptions().WithBatchSize(4).WithLinger(time.Hour))
+	defer publisher.Close(context.Background())
+
+	for i := 0; i < 4; i++ {
+		msg := NewMessage("orders", []byte("body"))
+		msg.UUID = fmt.Sprint(i)
+		publisher.Publish(msg)
+	}
+
+	resp, err := publisher.Flush(context.Background())
+	if decodeErrCode(err) != ErrCodeValidation {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	// The messages written before the failure were aborted with the stream
+	if len(resp.Uncertain) != 2 || resp.Uncertain[0].UUID != "0" || resp.Uncertain[1].UUID != "1" {
+		t.Errorf("Expected messages 0 and 1 to be uncertain, got %v", resp.Uncertain)
+	}
+	if len(resp.Unsent) != 2 || resp.Unsent[0].UUID != "2" || resp.Unsent[1].UUID != "3" {
+		t.Errorf("Expected messages 2 and 3 to be unsent, got %v", resp.Unsent)
+	}
+
+	// A successful flush reports nothing uncertain
+	publisher.Publish(NewMessage("orders", []byte("body")))
+	if resp, err := publisher.Flush(context.Background()); err != nil || len(resp.Uncertain) != 0 {
+		t.Errorf("Expected an acknowledged flush, got %+v %v", resp, err)
+	}
+}
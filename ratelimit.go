@@ -0,0 +1,305 @@
+package togomq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitMode is the behavior of a publish that exceeds a rate limit
+type RateLimitMode string
+
+const (
+	// RateLimitBlock waits until the message fits in the rate limit (default)
+	RateLimitBlock RateLimitMode = "block"
+	// RateLimitFailFast aborts the publish with an ErrCodeRateLimit error
+	RateLimitFailFast RateLimitMode = "fail_fast"
+	// RateLimitShed drops the message as if a middleware returned ErrSkipMessage
+	RateLimitShed RateLimitMode = "shed"
+)
+
+// validate checks if the rate limit mode is supported
+func (m RateLimitMode) validate() error {
+	switch m {
+	case "", RateLimitBlock, RateLimitFailFast, RateLimitShed:
+		return nil
+	default:
+		return fmt.Errorf("unsupported rate limit mode %q", string(m))
+	}
+}
+
+// strictness orders the modes when a message exceeds several limits
+func (m RateLimitMode) strictness() int {
+	switch m {
+	case RateLimitShed:
+		return 2
+	case RateLimitFailFast:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// RateLimitOptions configures a token bucket rate limit of published messages.
+// Bytes are counted after compression and encryption, as sent to the server.
+type RateLimitOptions struct {
+	// MessagesPerSec is the sustained number of messages per second (0 = unlimited)
+	MessagesPerSec float64
+	// BytesPerSec is the sustained number of bytes per second (0 = unlimited)
+	BytesPerSec int
+	// MessageBurst is the number of messages sent at once above the rate (default: one second of messages)
+	MessageBurst int
+	// ByteBurst is the number of bytes sent at once above the rate (default: one second of bytes).
+	// A message larger than the burst waits for a full bucket and delays the next ones.
+	ByteBurst int
+	// Mode is the behavior of a publish that exceeds the limit (default: block)
+	Mode RateLimitMode
+}
+
+// NewRateLimitOptions creates RateLimitOptions limiting the messages per second
+func NewRateLimitOptions(messagesPerSec float64) *RateLimitOptions {
+	return &RateLimitOptions{
+		MessagesPerSec: messagesPerSec,
+		Mode:           RateLimitBlock,
+	}
+}
+
+// WithBytesPerSec sets the sustained number of bytes per second
+func (o *RateLimitOptions) WithBytesPerSec(bytes int) *RateLimitOptions {
+	o.BytesPerSec = bytes
+	return o
+}
+
+// WithBurst sets the number of messages and bytes sent at once above the rate
+func (o *RateLimitOptions) WithBurst(messages, bytes int) *RateLimitOptions {
+	o.MessageBurst = messages
+	o.ByteBurst = bytes
+	return o
+}
+
+// WithMode sets the behavior of a publish that exceeds the limit
+func (o *RateLimitOptions) WithMode(mode RateLimitMode) *RateLimitOptions {
+	o.Mode = mode
+	return o
+}
+
+// validate checks if the rate limit options are valid
+func (o *RateLimitOptions) validate() error {
+	if o.MessagesPerSec < 0 || o.BytesPerSec < 0 {
+		return fmt.Errorf("rate limit rates cannot be negative")
+	}
+	if o.MessagesPerSec == 0 && o.BytesPerSec == 0 {
+		return fmt.Errorf("rate limit requires messages or bytes per second")
+	}
+	if o.MessageBurst < 0 || o.ByteBurst < 0 {
+		return fmt.Errorf("rate limit bursts cannot be negative")
+	}
+	return o.Mode.validate()
+}
+
+// TopicRateLimit is a rate limit shared by the topics matching a pattern, see MatchTopic
+type TopicRateLimit struct {
+	Pattern string
+	Limit   *RateLimitOptions
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens per second
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket; a burst of 0 holds one second of tokens
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := &tokenBucket{rate: rate, burst: float64(burst), last: now}
+	if b.burst == 0 {
+		b.burst = math.Max(rate, 1)
+	}
+	b.tokens = b.burst
+	return b
+}
+
+// delay returns how long to wait until n tokens can be taken.
+// At most burst tokens are needed, so that n larger than the burst leaves the bucket in debt.
+func (b *tokenBucket) delay(n float64, now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	missing := math.Min(n, b.burst) - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(missing / b.rate * float64(time.Second)))
+}
+
+// take removes n tokens, which may leave the bucket in debt
+func (b *tokenBucket) take(n float64) {
+	b.tokens -= n
+}
+
+// limitBuckets are the token buckets of a RateLimitOptions
+type limitBuckets struct {
+	mode     RateLimitMode
+	messages *tokenBucket // nil when messages are unlimited
+	bytes    *tokenBucket // nil when bytes are unlimited
+}
+
+// newLimitBuckets creates the buckets of the options
+func newLimitBuckets(opts *RateLimitOptions, now time.Time) *limitBuckets {
+	l := &limitBuckets{mode: opts.Mode}
+	if opts.MessagesPerSec > 0 {
+		l.messages = newTokenBucket(opts.MessagesPerSec, opts.MessageBurst, now)
+	}
+	if opts.BytesPerSec > 0 {
+		l.bytes = newTokenBucket(float64(opts.BytesPerSec), opts.ByteBurst, now)
+	}
+	return l
+}
+
+// delay returns how long to wait until a message of size bytes fits in the limit
+func (l *limitBuckets) delay(size int, now time.Time) time.Duration {
+	var d time.Duration
+	if l.messages != nil {
+		d = l.messages.delay(1, now)
+	}
+	if l.bytes != nil {
+		d = max(d, l.bytes.delay(float64(size), now))
+	}
+	return d
+}
+
+// take removes the tokens of a message of size bytes
+func (l *limitBuckets) take(size int) {
+	if l.messages != nil {
+		l.messages.take(1)
+	}
+	if l.bytes != nil {
+		l.bytes.take(float64(size))
+	}
+}
+
+// topicBuckets are the buckets of a topic pattern
+type topicBuckets struct {
+	pattern string
+	buckets *limitBuckets
+}
+
+// rateLimiter applies the global and topic rate limits to published messages
+type rateLimiter struct {
+	mu     sync.Mutex
+	global *limitBuckets // nil without global limit
+	topics []topicBuckets
+}
+
+// newRateLimiter creates the buckets of the configured rate limits
+func newRateLimiter(config *Config) *rateLimiter {
+	now := time.Now()
+	l := &rateLimiter{}
+	if config.RateLimit != nil {
+		l.global = newLimitBuckets(config.RateLimit, now)
+	}
+	for _, topic := range config.TopicRateLimits {
+		l.topics = append(l.topics, topicBuckets{pattern: topic.Pattern, buckets: newLimitBuckets(topic.Limit, now)})
+	}
+	return l
+}
+
+// limits returns the global limit and the first topic limit matching the topic
+func (l *rateLimiter) limits(topic string) []*limitBuckets {
+	var limits []*limitBuckets
+	if l.global != nil {
+		limits = append(limits, l.global)
+	}
+	for _, t := range l.topics {
+		if MatchTopic(t.pattern, topic) {
+			return append(limits, t.buckets)
+		}
+	}
+	return limits
+}
+
+// wait takes the tokens of a message, waiting for them unless a limit sheds or fails fast.
+// It returns the strictest mode of the limits that were exceeded, or "" when none was.
+// A message is only admitted when it fits in all its limits at once.
+func (l *rateLimiter) wait(ctx context.Context, topic string, size int) (RateLimitMode, error) {
+	limits := l.limits(topic)
+	var limited RateLimitMode
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var delay time.Duration
+		mode := RateLimitBlock
+		for _, limit := range limits {
+			if d := limit.delay(size, now); d > 0 {
+				delay = max(delay, d)
+				if limit.mode.strictness() > mode.strictness() {
+					mode = limit.mode
+				}
+			}
+		}
+		if delay == 0 {
+			for _, limit := range limits {
+				limit.take(size)
+			}
+		}
+		l.mu.Unlock()
+
+		if delay == 0 {
+			return limited, nil
+		}
+		if limited == "" {
+			limited = mode
+		}
+		if mode != RateLimitBlock {
+			return mode, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return limited, ctx.Err()
+		}
+	}
+}
+
+// rateLimiter returns the rate limiter of the client, created on first use
+func (c *Client) rateLimiter() *rateLimiter {
+	c.limiterOnce.Do(func() {
+		c.limiter = newRateLimiter(c.config)
+	})
+	return c.limiter
+}
+
+// rateLimitPublish is the built-in publish middleware applying the rate limits
+func (c *Client) rateLimitPublish(next Handler) Handler {
+	limiter := c.rateLimiter()
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		mode, err := limiter.wait(ctx, msg.Topic, msg.size())
+		if mode != "" {
+			c.rateLimited(msg.Topic, mode)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch mode {
+		case RateLimitShed:
+			if c.logger.enabled(slog.LevelDebug) {
+				c.log(ctx).With(LogKeyTopic, msg.Topic).Debug("Message shed by the rate limit")
+			}
+			return ErrSkipMessage
+		case RateLimitFailFast:
+			return NewError(ErrCodeRateLimit, fmt.Sprintf("publish rate limit exceeded for topic %s", msg.Topic), nil)
+		default:
+			return next.Handle(ctx, msg)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+// rateLimitedMetrics records the RateLimited calls
+type rateLimitedMetrics struct {
+	NoopMetrics
+	mu      sync.Mutex
+	limited []string
+}
+
+func (m *rateLimitedMetrics) RateLimited(topic string, mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limited = append(m.limited, topic+"/"+mode)
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(10, 2, start)
+
+	for i := 0; i < 2; i++ {
+		if d := b.delay(1, start); d != 0 {
+			t.Fatalf("Expected the burst to be available, got delay %v", d)
+		}
+		b.take(1)
+	}
+	if d := b.delay(1, start); d != 100*time.Millisecond {
+		t.Errorf("Expected a delay of 100ms for an empty bucket, got %v", d)
+	}
+	if d := b.delay(1, start.Add(100*time.Millisecond)); d != 0 {
+		t.Errorf("Expected a token after 100ms, got delay %v", d)
+	}
+	// The bucket never holds more than the burst
+	if d := b.delay(2, start.Add(time.Hour)); d != 0 || b.tokens != 2 {
+		t.Errorf("Expected a full bucket of 2 tokens, got %v tokens", b.tokens)
+	}
+
+	// Requests larger than the burst wait for a full bucket and leave it in debt
+	b.take(5)
+	if d := b.delay(5, start.Add(time.Hour)); d != 500*time.Millisecond {
+		t.Errorf("Expected a delay of 500ms to refill 5 tokens, got %v", d)
+	}
+
+	if b := newTokenBucket(0.5, 0, start); b.burst != 1 {
+		t.Errorf("Expected a default burst of at least 1, got %v", b.burst)
+	}
+}
+
+func TestRateLimit_Block(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+	metrics := &rateLimitedMetrics{}
+	client.config.Metrics = metrics
+	client.config.RateLimit = NewRateLimitOptions(50).WithBurst(1, 0)
+
+	start := time.Now()
+	resp, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("orders", []byte("1")),
+		NewMessage("orders", []byte("2")),
+		NewMessage("orders", []byte("3")),
+	})
+	if err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if resp.MessagesSent != 3 {
+		t.Errorf("Expected 3 messages sent, got %d", resp.MessagesSent)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected the publish to be throttled to 50/s, took %v", elapsed)
+	}
+	if len(metrics.limited) != 2 || metrics.limited[0] != "orders/block" {
+		t.Errorf("Expected 2 blocked messages, got %v", metrics.limited)
+	}
+
+	// A blocked publish gives up with its context
+	client.config.RateLimit = NewRateLimitOptions(0.001)
+	client.limiterOnce, client.limiter = sync.Once{}, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = client.PubBatch(ctx, []*Message{NewMessage("orders", nil), NewMessage("orders", nil)})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context deadline, got %v", err)
+	}
+}
+
+func TestRateLimit_FailFast(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+	client.config.RateLimit = NewRateLimitOptions(1).WithMode(RateLimitFailFast)
+
+	messages := []*Message{NewMessage("orders", []byte("1")), NewMessage("orders", []byte("2"))}
+	resp, err := client.PubBatch(context.Background(), messages)
+	if !errors.Is(err, ErrRateLimit) || IsRetryable(err) || !IsTemporary(err) {
+		t.Fatalf("Expected a temporary, not retryable rate limit error, got %v", err)
+	}
+	if resp.MessagesSent != 1 || len(resp.Unsent) != 1 || resp.Unsent[0] != messages[1] {
+		t.Errorf("Expected the second message to be unsent, got %+v", resp)
+	}
+}
+
+func TestRateLimit_FailFastNotRetried(t *testing.T) {
+	srv := recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest))
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+	client.config.RateLimit = NewRateLimitOptions(1).WithMode(RateLimitFailFast)
+
+	// The first batch uses the burst, so the second one fails before anything is sent
+	if _, err := client.PubBatch(context.Background(), []*Message{NewMessage("orders", nil)}); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	messages := []*Message{NewMessage("orders", []byte("1")), NewMessage("orders", []byte("2"))}
+	resp, err := client.PubBatch(context.Background(), messages)
+	var tmqErr *TogoMQError
+	if !errors.As(err, &tmqErr) || tmqErr.Code != ErrCodeRateLimit {
+		t.Fatalf("Expected a rate limit error, got %v", err)
+	}
+	if tmqErr.Retries != 0 {
+		t.Errorf("Expected a single attempt, got %d retries", tmqErr.Retries)
+	}
+	// The stream of the failed attempt may be cancelled before the server sees it
+	if _, pub := srv.calls(); pub > 2 {
+		t.Errorf("Expected at most 2 publish streams, got %d", pub)
+	}
+	if resp.MessagesSent != 0 || len(resp.Unsent) != len(messages) {
+		t.Errorf("Expected the whole batch to be unsent, got %+v", resp)
+	}
+}
+
+func TestRateLimit_ShedBytes(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+	metrics := &rateLimitedMetrics{}
+	client.config.Metrics = metrics
+	// Only the bytes are limited, to one burst of 100 bytes
+	client.config.RateLimit = &RateLimitOptions{BytesPerSec: 1, ByteBurst: 100, Mode: RateLimitShed}
+
+	resp, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("orders", []byte(strings.Repeat("a", 60))),
+		NewMessage("orders", []byte(strings.Repeat("b", 60))),
+		NewMessage("orders", []byte("c")),
+	})
+	if err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if resp.MessagesSent != 2 || resp.MessagesSkipped != 1 {
+		t.Errorf("Expected 2 sent and 1 shed, got %d sent and %d skipped", resp.MessagesSent, resp.MessagesSkipped)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || string(received[1].Body) != "c" {
+		t.Errorf("Expected the second message to be shed, got %d messages", len(received))
+	}
+	if len(metrics.limited) != 1 || metrics.limited[0] != "orders/shed" {
+		t.Errorf("Expected 1 shed message, got %v", metrics.limited)
+	}
+}
+
+func TestRateLimit_TopicPatterns(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+	client.config.TopicRateLimits = []TopicRateLimit{
+		{Pattern: "orders.*", Limit: NewRateLimitOptions(1).WithMode(RateLimitFailFast)},
+		{Pattern: "*", Limit: NewRateLimitOptions(1).WithMode(RateLimitShed)},
+	}
+
+	// Both orders topics share the bucket of their pattern
+	_, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("orders.created", nil),
+		NewMessage("orders.paid", nil),
+	})
+	if !errors.Is(err, ErrRateLimit) {
+		t.Errorf("Expected orders.* to fail fast, got %v", err)
+	}
+
+	// Other topics use the first matching pattern only
+	resp, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("audit", nil),
+		NewMessage("audit", nil),
+	})
+	if err != nil || resp.MessagesSent != 1 || resp.MessagesSkipped != 1 {
+		t.Errorf("Expected * to shed the second message, got %+v %v", resp, err)
+	}
+}
+
+func TestRateLimit_StrictestMode(t *testing.T) {
+	client := newTestClient(t, recordingPubServer(new(sync.Mutex), new([]*mqv1.PubMessageRequest)))
+	client.config.RateLimit = NewRateLimitOptions(1).WithMode(RateLimitShed)
+	client.config.TopicRateLimits = []TopicRateLimit{
+		{Pattern: "orders", Limit: NewRateLimitOptions(1000)},
+	}
+
+	resp, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("orders", nil),
+		NewMessage("orders", nil),
+	})
+	if err != nil || resp.MessagesSkipped != 1 {
+		t.Errorf("Expected the global limit to shed the second message, got %+v %v", resp, err)
+	}
+}
+
+func TestConfig_ValidateRateLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ConfigOption
+		want string
+	}{
+		{"no rate", WithRateLimit(NewRateLimitOptions(0)), "requires messages or bytes per second"},
+		{"negative rate", WithRateLimit(NewRateLimitOptions(-1)), "cannot be negative"},
+		{"unknown mode", WithRateLimit(NewRateLimitOptions(1).WithMode("queue")), "unsupported rate limit mode"},
+		{"no pattern", WithTopicRateLimit("", NewRateLimitOptions(1)), "require a pattern and a limit"},
+		{"invalid topic limit", WithTopicRateLimit("orders", NewRateLimitOptions(1).WithBurst(-1, 0)), "topic orders: rate limit bursts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewConfig(WithToken("t"), tt.opt).Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnv_RateLimit(t *testing.T) {
+	t.Setenv("TOGOMQ_RATE_LIMIT_MESSAGES_PER_SEC", "250")
+	t.Setenv("TOGOMQ_RATE_LIMIT_BYTES_PER_SEC", "1MB")
+	t.Setenv("TOGOMQ_RATE_LIMIT_MODE", "shed")
+
+	cfg, err := ConfigFromEnv("")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if cfg.RateLimit == nil || cfg.RateLimit.MessagesPerSec != 250 || cfg.RateLimit.BytesPerSec != 1<<20 ||
+		cfg.RateLimit.Mode != RateLimitShed {
+		t.Errorf("Unexpected rate limit: %+v", cfg.RateLimit)
+	}
+	if s := cfg.String(); !strings.Contains(s, "rateLimit.mode=shed") || !strings.Contains(s, "rateLimit.bytesPerSec=1MB") {
+		t.Errorf("Expected the rate limit in %s", s)
+	}
+}
@@ -0,0 +1,101 @@
+package togomq
+
+import (
+	"context"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+)
+
+// ReconnectOptions configures the resilient subscription mode of Client.Sub.
+// When set on SubscribeOptions, the subscription re-opens the stream after
+// temporary failures (see IsTemporary) instead of closing the message channel.
+type ReconnectOptions struct {
+	// Backoff is the delay curve between reconnect attempts
+	Backoff Backoff
+	// MaxAttempts is the maximum number of consecutive reconnect attempts (0 = unlimited)
+	MaxAttempts int
+	// OnReconnect is called before every reconnect attempt (optional)
+	OnReconnect func(ReconnectEvent)
+}
+
+// ReconnectEvent describes a reconnect attempt of a subscription
+type ReconnectEvent struct {
+	// Topic is the topic pattern of the subscription
+	Topic string
+	// Attempt is the number of the consecutive reconnect attempt, starting at 1
+	Attempt int
+	// Delay is the backoff delay waited before the attempt
+	Delay time.Duration
+	// Err is the error that caused the reconnect
+	Err error
+}
+
+// NewReconnectOptions creates reconnect options with the default backoff and unlimited attempts
+func NewReconnectOptions() *ReconnectOptions {
+	return &ReconnectOptions{
+		Backoff:     DefaultBackoff(),
+		MaxAttempts: 0, // unlimited
+	}
+}
+
+// WithBackoff sets the backoff curve
+func (r *ReconnectOptions) WithBackoff(backoff Backoff) *ReconnectOptions {
+	r.Backoff = backoff
+	return r
+}
+
+// WithMaxAttempts sets the maximum number of consecutive reconnect attempts
+func (r *ReconnectOptions) WithMaxAttempts(attempts int) *ReconnectOptions {
+	r.MaxAttempts = attempts
+	return r
+}
+
+// WithOnReconnect sets the callback invoked before every reconnect attempt
+func (r *ReconnectOptions) WithOnReconnect(fn func(ReconnectEvent)) *ReconnectOptions {
+	r.OnReconnect = fn
+	return r
+}
+
+// reconnectSub re-opens the subscribe stream with backoff until it succeeds,
+// the context is done, the attempts are exhausted or an error that is not temporary occurs.
+// The server's RetryInfo delay is waited at least between attempts.
+// attempt holds the number of consecutive attempts already made and is updated in place.
+func (c *Client) reconnectSub(ctx context.Context, opts *SubscribeOptions, attempt *int, cause error) (mqv1.MqService_SubMessageClient, error) {
+	policy := opts.Reconnect
+	log := c.log(ctx).With(LogKeyTopic, opts.Topic)
+	for {
+		if !IsTemporary(cause) {
+			return nil, cause
+		}
+		if policy.MaxAttempts > 0 && *attempt >= policy.MaxAttempts {
+			log.WithError(cause).With("attempt", *attempt).Error("Giving up reconnecting")
+			return nil, cause
+		}
+
+		*attempt++
+		c.metrics().Reconnect(opts.Topic)
+		delay := retryDelay(policy.Backoff, *attempt, cause)
+		log.WithError(cause).With("attempt", *attempt).Warn("Subscription lost, reconnecting in %v", delay)
+
+		if policy.OnReconnect != nil {
+			policy.OnReconnect(ReconnectEvent{
+				Topic:   opts.Topic,
+				Attempt: *attempt,
+				Delay:   delay,
+				Err:     cause,
+			})
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		stream, err := c.client.SubMessage(ctx, opts.toSubRequest())
+		if err == nil {
+			log.Info("Subscription re-established")
+			return stream, nil
+		}
+		cause = c.wrapError(ctx, err, "failed to re-create subscribe stream")
+	}
+}
@@ -0,0 +1,203 @@
+package togomq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func fastReconnect() *ReconnectOptions {
+	return NewReconnectOptions().WithBackoff(Backoff{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+	})
+}
+
+func TestSub_ReconnectAfterUnavailable(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			switch call {
+			case 1:
+				stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: "1", Body: []byte("first")})
+				return status.Error(codes.Unavailable, "server restarting")
+			default:
+				stream.Send(&mqv1.SubMessageResponse{Topic: req.Topic, Uuid: "2", Body: []byte("second")})
+				<-stream.Context().Done()
+				return nil
+			}
+		},
+	}
+	client := newTestClient(t, srv)
+
+	var mu sync.Mutex
+	var events []ReconnectEvent
+	reconnect := fastReconnect().WithOnReconnect(func(e ReconnectEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, errChan, err := client.Sub(ctx, NewSubscribeOptions("orders").WithReconnect(reconnect))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	for _, expected := range []string{"1", "2"} {
+		select {
+		case msg := <-msgChan:
+			if msg == nil || msg.UUID != expected {
+				t.Fatalf("Expected message %s, got %+v", expected, msg)
+			}
+		case err := <-errChan:
+			t.Fatalf("Unexpected error: %v", err)
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for messages")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 reconnect event, got %d", len(events))
+	}
+	if events[0].Attempt != 1 || events[0].Topic != "orders" {
+		t.Errorf("Unexpected reconnect event: %+v", events[0])
+	}
+	if code := events[0].Err.(*TogoMQError).Code; code != ErrCodeConnection {
+		t.Errorf("Expected cause code %s, got %s", ErrCodeConnection, code)
+	}
+}
+
+func TestSub_ReconnectGivesUpOnNonRetryable(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			return status.Error(codes.Unauthenticated, "invalid token")
+		},
+	}
+	client := newTestClient(t, srv)
+
+	msgChan, errChan, err := client.Sub(context.Background(), NewSubscribeOptions("orders").WithReconnect(fastReconnect()))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	err = <-errChan
+	tmqErr, ok := err.(*TogoMQError)
+	if !ok || tmqErr.Code != ErrCodeAuth {
+		t.Fatalf("Expected %s error, got %v", ErrCodeAuth, err)
+	}
+	if _, ok := <-msgChan; ok {
+		t.Error("Expected message channel to be closed")
+	}
+	if sub, _ := srv.calls(); sub != 1 {
+		t.Errorf("Expected 1 subscribe call, got %d", sub)
+	}
+}
+
+func TestSub_ReconnectMaxAttempts(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			return status.Error(codes.Unavailable, "down")
+		},
+	}
+	client := newTestClient(t, srv)
+
+	opts := NewSubscribeOptions("orders").WithReconnect(fastReconnect().WithMaxAttempts(2))
+	_, errChan, err := client.Sub(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	err = <-errChan
+	tmqErr, ok := err.(*TogoMQError)
+	if !ok || tmqErr.Code != ErrCodeConnection {
+		t.Fatalf("Expected %s error, got %v", ErrCodeConnection, err)
+	}
+	if sub, _ := srv.calls(); sub != 3 {
+		t.Errorf("Expected 3 subscribe calls, got %d", sub)
+	}
+}
+
+func TestSub_ReconnectServerRetryDelay(t *testing.T) {
+	const serverDelay = 50 * time.Millisecond
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			if call == 1 {
+				return retryInfoError(t, codes.Unavailable, serverDelay)
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+
+	events := make(chan ReconnectEvent, 1)
+	reconnect := fastReconnect().WithOnReconnect(func(e ReconnectEvent) { events <- e })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, _, err := client.Sub(ctx, NewSubscribeOptions("orders").WithReconnect(reconnect)); err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Delay != serverDelay {
+			t.Errorf("Expected the server retry delay %v, got %v", serverDelay, e.Delay)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the reconnect")
+	}
+}
+
+func TestSub_WithoutReconnect(t *testing.T) {
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			return status.Error(codes.Unavailable, "down")
+		},
+	}
+	client := newTestClient(t, srv)
+
+	_, errChan, err := client.Sub(context.Background(), NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	if err := <-errChan; err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if sub, _ := srv.calls(); sub != 1 {
+		t.Errorf("Expected 1 subscribe call, got %d", sub)
+	}
+}
+
+func TestReconnect_Temporary(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{NewError(ErrCodeAuth, "auth", nil), false},
+		{NewError(ErrCodeValidation, "validation", nil), false},
+		{NewError(ErrCodeConfiguration, "config", nil), false},
+		{NewError(ErrCodePermissionDenied, "denied", nil), false},
+		{NewError(ErrCodeInternal, "internal", nil), false},
+		{NewError(ErrCodeConnection, "connection", nil), true},
+		{NewError(ErrCodeStream, "stream", nil), true},
+		{NewError(ErrCodeDeadlineExceeded, "timeout", nil), true},
+	}
+
+	for _, tt := range tests {
+		if result := IsTemporary(tt.err); result != tt.expected {
+			t.Errorf("IsTemporary(%v) = %v, expected %v", tt.err, result, tt.expected)
+		}
+	}
+}
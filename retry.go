@@ -0,0 +1,194 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy configures how Pub, PubBatch, Sub and CountMessages retry failed calls.
+//
+// Pub consumes messages from a channel that cannot be replayed, so only the creation of
+// its stream is retried. Sub also only retries the creation of its stream: errors received
+// on the stream end the subscription, unless it reconnects (see SubscribeOptions.WithReconnect).
+// PubBatch retries the whole batch, but once messages were written to the stream only when the
+// server failed it: a stream aborted by the client, e.g. by a middleware or rate limit error,
+// may have been partially stored, so it is not retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one (<= 1 disables retries)
+	MaxAttempts int
+	// Backoff is the delay curve between attempts
+	Backoff Backoff
+	// PerAttemptTimeout bounds the duration of every single attempt of PubBatch and CountMessages
+	// (0 = no limit). It does not apply to the streams of Pub and Sub, which live as long as their context.
+	PerAttemptTimeout time.Duration
+	// RetryableCodes are the gRPC status codes that are retried
+	RetryableCodes []codes.Code
+	// RetryableErrCodes are the ErrCode* values that are retried
+	RetryableErrCodes []ErrorCode
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with 3 attempts that retries the errors
+// reported by IsRetryable. gRPC errors are wrapped with their ErrCode* before they are
+// matched, so no gRPC status codes are listed.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:       3,
+		Backoff:           DefaultBackoff(),
+		PerAttemptTimeout: 0, // no limit
+		RetryableErrCodes: slices.Clone(retryableErrCodes),
+	}
+}
+
+// WithMaxAttempts sets the total number of attempts
+func (p *RetryPolicy) WithMaxAttempts(attempts int) *RetryPolicy {
+	p.MaxAttempts = attempts
+	return p
+}
+
+// WithBackoff sets the backoff curve
+func (p *RetryPolicy) WithBackoff(backoff Backoff) *RetryPolicy {
+	p.Backoff = backoff
+	return p
+}
+
+// WithPerAttemptTimeout sets the deadline applied to every attempt
+func (p *RetryPolicy) WithPerAttemptTimeout(timeout time.Duration) *RetryPolicy {
+	p.PerAttemptTimeout = timeout
+	return p
+}
+
+// WithRetryableCodes sets the retryable gRPC status codes
+func (p *RetryPolicy) WithRetryableCodes(retryable ...codes.Code) *RetryPolicy {
+	p.RetryableCodes = retryable
+	return p
+}
+
+// WithRetryableErrCodes sets the retryable ErrCode* values
+func (p *RetryPolicy) WithRetryableErrCodes(retryable ...ErrorCode) *RetryPolicy {
+	p.RetryableErrCodes = retryable
+	return p
+}
+
+// validate checks if the retry policy is valid
+func (p *RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("retry max attempts cannot be negative")
+	}
+	if p.PerAttemptTimeout < 0 {
+		return fmt.Errorf("retry per-attempt timeout cannot be negative")
+	}
+	return nil
+}
+
+// shouldRetry reports whether err matches one of the retryable codes of the policy.
+// gRPC errors that are not wrapped are matched against RetryableErrCodes by their mapped ErrCode*.
+func (p *RetryPolicy) shouldRetry(err error) bool {
+	st, isStatus := status.FromError(err)
+	if isStatus && slices.Contains(p.RetryableCodes, st.Code()) {
+		return true
+	}
+
+	var tmqErr *TogoMQError
+	if errors.As(err, &tmqErr) {
+		return slices.Contains(p.RetryableErrCodes, tmqErr.Code)
+	}
+	if code, ok := grpcErrorCodes[st.Code()]; isStatus && ok {
+		return slices.Contains(p.RetryableErrCodes, code)
+	}
+	return false
+}
+
+// retryPolicyKey is the context key for per-call retry policy overrides
+type retryPolicyKey struct{}
+
+// ContextWithRetryPolicy returns a context that overrides the client retry policy
+// for calls made with it. A nil policy disables retries for those calls.
+func ContextWithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retryPolicy returns the retry policy for a call, preferring a per-call override
+func (c *Client) retryPolicy(ctx context.Context) *RetryPolicy {
+	if policy, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		return policy
+	}
+	return c.config.RetryPolicy
+}
+
+// withRetry runs fn until it succeeds or the retry policy gives up.
+// When perAttempt is true, every attempt runs with the policy's per-attempt timeout.
+// The number of retries made is recorded on the returned TogoMQError.
+func (c *Client) withRetry(ctx context.Context, perAttempt bool, fn func(ctx context.Context) error) error {
+	policy := c.retryPolicy(ctx)
+
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if perAttempt && policy != nil && policy.PerAttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.PerAttemptTimeout)
+		}
+		err := fn(attemptCtx)
+		attemptTimedOut := attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		var final finalError
+		if errors.As(err, &final) {
+			return withRetries(final.err, attempt-1)
+		}
+		// A rejected token is refreshed once, without counting an attempt
+		if !refreshed && ctx.Err() == nil && c.refreshToken(ctx, err) {
+			refreshed = true
+			attempt--
+			continue
+		}
+		if policy == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil ||
+			!(attemptTimedOut || policy.shouldRetry(err)) {
+			return withRetries(err, attempt-1)
+		}
+
+		delay := retryDelay(policy.Backoff, attempt, err)
+		c.log(ctx).WithError(err).With("attempt", attempt).Warn("Call failed, retrying in %v", delay)
+		if sleepContext(ctx, delay) != nil {
+			return withRetries(err, attempt-1)
+		}
+	}
+}
+
+// retryDelay returns the backoff delay before the next attempt.
+// A delay requested by the server in a RetryInfo detail is waited at least.
+func retryDelay(backoff Backoff, attempt int, err error) time.Duration {
+	delay := backoff.Delay(attempt)
+	var tmqErr *TogoMQError
+	if errors.As(err, &tmqErr) {
+		if serverDelay, ok := tmqErr.RetryDelay(); ok && serverDelay > delay {
+			return serverDelay
+		}
+	}
+	return delay
+}
+
+// finalError is returned by an attempt that must not be repeated
+type finalError struct {
+	err error
+}
+
+func (e finalError) Error() string { return e.err.Error() }
+func (e finalError) Unwrap() error { return e.err }
+
+// withRetries records the retry count on a TogoMQError
+func withRetries(err error, retries int) error {
+	var tmqErr *TogoMQError
+	if errors.As(err, &tmqErr) {
+		tmqErr.Retries = retries
+	}
+	return err
+}
@@ -0,0 +1,350 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func fastRetryPolicy() *RetryPolicy {
+	return DefaultRetryPolicy().WithBackoff(Backoff{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+	})
+}
+
+// retryInfoError returns a gRPC error asking the client to retry after delay
+func retryInfoError(t *testing.T, code codes.Code, delay time.Duration) error {
+	t.Helper()
+	st, err := status.New(code, "retry later").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		t.Fatalf("WithDetails failed: %v", err)
+	}
+	return st.Err()
+}
+
+func TestCountMessages_Retry(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			if call < 3 {
+				return nil, status.Error(codes.Unavailable, "down")
+			}
+			return &mqv1.CountMessagesResponse{MessagesCount: 42}, nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+
+	count, err := client.CountMessages(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("CountMessages failed: %v", err)
+	}
+	if count != 42 {
+		t.Errorf("Expected count 42, got %d", count)
+	}
+}
+
+func TestCountMessages_RetryExhausted(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			return nil, status.Error(codes.Unavailable, "down")
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy().WithMaxAttempts(4)
+
+	_, err := client.CountMessages(context.Background(), "orders")
+	var tmqErr *TogoMQError
+	if !errors.As(err, &tmqErr) {
+		t.Fatalf("Expected TogoMQError, got %v", err)
+	}
+	if tmqErr.Retries != 3 {
+		t.Errorf("Expected 3 retries, got %d", tmqErr.Retries)
+	}
+	if srv.countCalls != 4 {
+		t.Errorf("Expected 4 calls, got %d", srv.countCalls)
+	}
+}
+
+func TestCountMessages_NoRetryOnNonRetryableCode(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+
+	_, err := client.CountMessages(context.Background(), "orders")
+	var tmqErr *TogoMQError
+	if !errors.As(err, &tmqErr) || tmqErr.Code != ErrCodeAuth {
+		t.Fatalf("Expected %s error, got %v", ErrCodeAuth, err)
+	}
+	if tmqErr.Retries != 0 {
+		t.Errorf("Expected 0 retries, got %d", tmqErr.Retries)
+	}
+	if srv.countCalls != 1 {
+		t.Errorf("Expected 1 call, got %d", srv.countCalls)
+	}
+}
+
+func TestCountMessages_PerCallOverride(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			return nil, status.Error(codes.Unavailable, "down")
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+
+	ctx := ContextWithRetryPolicy(context.Background(), nil)
+	if _, err := client.CountMessages(ctx, "orders"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if srv.countCalls != 1 {
+		t.Errorf("Expected 1 call with retries disabled, got %d", srv.countCalls)
+	}
+}
+
+func TestCountMessages_PerAttemptTimeout(t *testing.T) {
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			if call == 1 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &mqv1.CountMessagesResponse{MessagesCount: 7}, nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy().WithPerAttemptTimeout(50 * time.Millisecond)
+
+	count, err := client.CountMessages(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("CountMessages failed: %v", err)
+	}
+	if count != 7 {
+		t.Errorf("Expected count 7, got %d", count)
+	}
+}
+
+func TestCountMessages_ServerRetryDelay(t *testing.T) {
+	const serverDelay = 100 * time.Millisecond
+	srv := &fakeServer{
+		countFunc: func(ctx context.Context, call int, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+			if call == 1 {
+				return nil, retryInfoError(t, codes.ResourceExhausted, serverDelay)
+			}
+			return &mqv1.CountMessagesResponse{MessagesCount: 1}, nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+
+	start := time.Now()
+	if _, err := client.CountMessages(context.Background(), "orders"); err != nil {
+		t.Fatalf("CountMessages failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < serverDelay {
+		t.Errorf("Expected the server retry delay of %v to be waited, retried after %v", serverDelay, elapsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff := Backoff{InitialDelay: 50 * time.Millisecond, MaxDelay: time.Second, Multiplier: 1}
+
+	if delay := retryDelay(backoff, 1, WrapGRPCError(retryInfoError(t, codes.Unavailable, time.Second), "ctx")); delay != time.Second {
+		t.Errorf("Expected the server delay, got %v", delay)
+	}
+	if delay := retryDelay(backoff, 1, WrapGRPCError(retryInfoError(t, codes.Unavailable, time.Millisecond), "ctx")); delay != 50*time.Millisecond {
+		t.Errorf("Expected the backoff delay when it is longer, got %v", delay)
+	}
+	if delay := retryDelay(backoff, 1, NewError(ErrCodeConnection, "down", nil)); delay != 50*time.Millisecond {
+		t.Errorf("Expected the backoff delay without RetryInfo, got %v", delay)
+	}
+}
+
+// failingMiddleware returns a publish middleware that rejects the messages for which fail returns true,
+// given the number of messages handled so far, with a retryable error
+func failingMiddleware(fail func(calls int, msg *Message) bool) PublishMiddleware {
+	var mu sync.Mutex
+	calls := 0
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, msg *Message) error {
+			mu.Lock()
+			calls++
+			failed := fail(calls, msg)
+			mu.Unlock()
+			if failed {
+				return NewError(ErrCodeConnection, "connection lost", nil)
+			}
+			return next.Handle(ctx, msg)
+		})
+	}
+}
+
+// countingPubServer returns a fakeServer that counts the messages it stores, acknowledges streams
+// and signals every stream that ends, completed or not
+func countingPubServer(stored *atomic.Int64, ended chan<- struct{}) *fakeServer {
+	return &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			defer func() { ended <- struct{}{} }()
+			var received int64
+			for {
+				_, err := stream.Recv()
+				if err == io.EOF {
+					return stream.SendAndClose(&mqv1.PubMessageResponse{MessagesReceived: received})
+				}
+				if err != nil {
+					return err
+				}
+				stored.Add(1)
+				received++
+			}
+		},
+	}
+}
+
+func TestPubBatch_Retry(t *testing.T) {
+	srv := &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			var received int64
+			for {
+				_, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				received++
+			}
+			if call == 1 {
+				return status.Error(codes.Unavailable, "down")
+			}
+			return stream.SendAndClose(&mqv1.PubMessageResponse{MessagesReceived: received})
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+
+	resp, err := client.PubBatch(context.Background(), []*Message{
+		NewMessage("orders", []byte("1")),
+		NewMessage("orders", []byte("2")),
+	})
+	if err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if resp.MessagesReceived != 2 {
+		t.Errorf("Expected 2 messages received, got %d", resp.MessagesReceived)
+	}
+	if _, pub := srv.calls(); pub != 2 {
+		t.Errorf("Expected 2 publish calls, got %d", pub)
+	}
+}
+
+func TestPubBatch_NoRetryAfterPartialSend(t *testing.T) {
+	var stored atomic.Int64
+	ended := make(chan struct{}, 10)
+	srv := countingPubServer(&stored, ended)
+	client := newTestClient(t, srv)
+	client.config.RetryPolicy = fastRetryPolicy()
+	// The first attempt fails before any message is written, the second one once the server
+	// stored two messages
+	client.config.PublishMiddleware = []PublishMiddleware{failingMiddleware(func(calls int, msg *Message) bool {
+		if string(msg.Body) == "3" {
+			for deadline := time.Now().Add(5 * time.Second); stored.Load() < 2 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			return true
+		}
+		return calls == 1
+	})}
+
+	messages := []*Message{
+		NewMessage("orders", []byte("1")),
+		NewMessage("orders", []byte("2")),
+		NewMessage("orders", []byte("3")),
+	}
+	resp, err := client.PubBatch(context.Background(), messages)
+	if decodeErrCode(err) != ErrCodeConnection {
+		t.Fatalf("Expected a %s error, got %v", ErrCodeConnection, err)
+	}
+	if _, pub := srv.calls(); pub != 2 {
+		t.Errorf("Expected 2 publish calls, got %d", pub)
+	}
+
+	// Both streams are cancelled when their attempt fails
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ended:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the failed streams to be cancelled")
+		}
+	}
+
+	// Re-queuing Unsent publishes every message exactly once
+	if stored.Load()+int64(len(resp.Unsent)) != int64(len(messages)) {
+		t.Errorf("Expected the stored and unsent messages to add up to %d, got %d + %d", len(messages), stored.Load(), len(resp.Unsent))
+	}
+	if resp.FirstUnsentIndex != 2 || len(resp.Unsent) != 1 || resp.Unsent[0] != messages[2] {
+		t.Errorf("Expected message 3 to be unsent, got index %d and %v", resp.FirstUnsentIndex, resp.Unsent)
+	}
+	if len(resp.Uncertain) != 2 || resp.Uncertain[0] != messages[0] || resp.Uncertain[1] != messages[1] {
+		t.Errorf("Expected messages 1 and 2 to be uncertain, got %v", resp.Uncertain)
+	}
+	var tmqErr *TogoMQError
+	if errors.As(err, &tmqErr) && tmqErr.Retries != 1 {
+		t.Errorf("Expected 1 retry, got %d", tmqErr.Retries)
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"unavailable", WrapGRPCError(status.Error(codes.Unavailable, "down"), "ctx"), true},
+		{"resource exhausted", WrapGRPCError(status.Error(codes.ResourceExhausted, "quota"), "ctx"), true},
+		{"internal", WrapGRPCError(status.Error(codes.Internal, "bug"), "ctx"), false},
+		{"unauthenticated", WrapGRPCError(status.Error(codes.Unauthenticated, "token"), "ctx"), false},
+		{"connection error code", NewError(ErrCodeConnection, "down", nil), true},
+		{"validation error code", NewError(ErrCodeValidation, "bad", nil), false},
+		{"rate limit error code", NewError(ErrCodeRateLimit, "shed", nil), false},
+		{"unwrapped unavailable", status.Error(codes.Unavailable, "down"), true},
+		{"unwrapped internal", status.Error(codes.Internal, "bug"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := policy.shouldRetry(tt.err); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestConfigValidation_RetryPolicy(t *testing.T) {
+	cfg := NewConfig(WithToken("mytoken"), WithRetryPolicy(DefaultRetryPolicy().WithMaxAttempts(-1)))
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative max attempts, got nil")
+	}
+
+	cfg = NewConfig(WithToken("mytoken"), WithRetryPolicy(DefaultRetryPolicy()))
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
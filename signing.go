@@ -0,0 +1,390 @@
+package togomq
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Reserved message variables of signed messages
+const (
+	// VariableSignature holds the signature, base64 encoded
+	VariableSignature = "signature"
+	// VariableSignatureKeyID holds the ID of the signing key
+	VariableSignatureKeyID = "signature-key-id"
+	// VariableSignatureAlgorithm holds the signature algorithm
+	VariableSignatureAlgorithm = "signature-algorithm"
+	// VariableSignatureStatus is set on received messages when signatures are verified
+	VariableSignatureStatus = "signature-status"
+	// VariableDeadLetterReason holds why a message was dead-lettered
+	VariableDeadLetterReason = "dead-letter-reason"
+	// VariableDeadLetterTopic holds the original topic of a dead-lettered message
+	VariableDeadLetterTopic = "dead-letter-topic"
+)
+
+// Signature algorithms
+const (
+	SignatureHMACSHA256 = "hmac-sha256"
+	SignatureEd25519    = "ed25519"
+)
+
+// Values of VariableSignatureStatus
+const (
+	SignatureStatusValid   = "valid"
+	SignatureStatusInvalid = "invalid"
+	SignatureStatusMissing = "missing"
+)
+
+// SigningKey signs and verifies messages
+type SigningKey interface {
+	// ID identifies the key in the signature-key-id variable
+	ID() string
+	// Algorithm is the signature algorithm
+	Algorithm() string
+	// Sign signs data
+	Sign(data []byte) ([]byte, error)
+	// Verify reports whether signature is a valid signature of data
+	Verify(data, signature []byte) bool
+}
+
+// hmacKey is a SigningKey using HMAC-SHA256
+type hmacKey struct {
+	id     string
+	secret []byte
+}
+
+// NewHMACKey creates an HMAC-SHA256 key that signs and verifies messages
+func NewHMACKey(id string, secret []byte) SigningKey {
+	return &hmacKey{id: id, secret: append([]byte(nil), secret...)}
+}
+
+func (k *hmacKey) ID() string        { return k.id }
+func (k *hmacKey) Algorithm() string { return SignatureHMACSHA256 }
+
+func (k *hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k *hmacKey) Verify(data, signature []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+// ed25519Key is a SigningKey using Ed25519; without a private key it only verifies
+type ed25519Key struct {
+	id      string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// NewEd25519Key creates an Ed25519 key that signs and verifies messages
+func NewEd25519Key(id string, private ed25519.PrivateKey) (SigningKey, error) {
+	if len(private) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 private key %q: %d bytes instead of %d", id, len(private), ed25519.PrivateKeySize)
+	}
+	return &ed25519Key{id: id, private: private, public: private.Public().(ed25519.PublicKey)}, nil
+}
+
+// NewEd25519PublicKey creates an Ed25519 key that only verifies messages
+func NewEd25519PublicKey(id string, public ed25519.PublicKey) SigningKey {
+	return &ed25519Key{id: id, public: public}
+}
+
+func (k *ed25519Key) ID() string        { return k.id }
+func (k *ed25519Key) Algorithm() string { return SignatureEd25519 }
+
+func (k *ed25519Key) Sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, fmt.Errorf("ed25519 key %q has no private key", k.id)
+	}
+	return ed25519.Sign(k.private, data), nil
+}
+
+func (k *ed25519Key) Verify(data, signature []byte) bool {
+	return len(k.public) == ed25519.PublicKeySize && ed25519.Verify(k.public, data, signature)
+}
+
+// VerifyMode is the action taken on received messages with a missing or bad signature
+type VerifyMode int
+
+const (
+	// VerifyReject drops the message and passes it to the consume error handler
+	VerifyReject VerifyMode = iota
+	// VerifyFlag delivers the message with the signature-status variable set
+	VerifyFlag
+	// VerifyDeadLetter publishes the message as received to the dead-letter topic and drops it.
+	// Dead letters are sent in the background; those that cannot be sent are passed to the
+	// consume error handler.
+	VerifyDeadLetter
+)
+
+// SigningOptions configures message signing and signature verification
+type SigningOptions struct {
+	// Key signs published messages (nil = messages are published unsigned)
+	Key SigningKey
+	// VerifyKeys verify received messages by key ID (empty = signatures are not verified)
+	VerifyKeys []SigningKey
+	// Mode is the action taken on messages with a missing or bad signature (default: VerifyReject)
+	Mode VerifyMode
+	// DeadLetterTopic receives the messages with a bad signature in VerifyDeadLetter mode
+	DeadLetterTopic string
+}
+
+// NewSigningOptions creates signing options that sign published messages with key
+// and verify received messages with it
+func NewSigningOptions(key SigningKey) *SigningOptions {
+	return &SigningOptions{
+		Key:        key,
+		VerifyKeys: []SigningKey{key},
+		Mode:       VerifyReject,
+	}
+}
+
+// WithVerifyKeys sets the keys that verify received messages
+func (o *SigningOptions) WithVerifyKeys(keys ...SigningKey) *SigningOptions {
+	o.VerifyKeys = keys
+	return o
+}
+
+// WithMode sets the action taken on messages with a missing or bad signature
+func (o *SigningOptions) WithMode(mode VerifyMode) *SigningOptions {
+	o.Mode = mode
+	return o
+}
+
+// WithDeadLetterTopic sets the dead-letter topic and selects VerifyDeadLetter mode
+func (o *SigningOptions) WithDeadLetterTopic(topic string) *SigningOptions {
+	o.DeadLetterTopic = topic
+	o.Mode = VerifyDeadLetter
+	return o
+}
+
+// validate checks if the signing options are valid
+func (o *SigningOptions) validate() error {
+	switch o.Mode {
+	case VerifyReject, VerifyFlag:
+	case VerifyDeadLetter:
+		if o.DeadLetterTopic == "" {
+			return fmt.Errorf("dead-letter topic is required in dead-letter verify mode")
+		}
+	default:
+		return fmt.Errorf("unsupported verify mode %d", o.Mode)
+	}
+	return nil
+}
+
+// verifyKey returns the verify key with the ID
+func (o *SigningOptions) verifyKey(id string) SigningKey {
+	for _, key := range o.VerifyKeys {
+		if key.ID() == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// signingPayload returns the canonical encoding of the signed parts of a message:
+// topic, body and variables sorted by key, each length-prefixed, without the signature variables
+func signingPayload(topic string, body []byte, variables map[string]string) []byte {
+	keys := make([]string, 0, len(variables))
+	for k := range variables {
+		switch k {
+		case VariableSignature, VariableSignatureStatus:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf []byte
+	field := func(b []byte) {
+		buf = binary.AppendUvarint(buf, uint64(len(b)))
+		buf = append(buf, b...)
+	}
+	field([]byte(topic))
+	field(body)
+	for _, k := range keys {
+		field([]byte(k))
+		field([]byte(variables[k]))
+	}
+	return buf
+}
+
+// signPublish is the built-in publish middleware that signs messages.
+// The caller's message is left untouched.
+func (c *Client) signPublish(next Handler) Handler {
+	key := c.config.Signing.Key
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		signed := *msg
+		signed.Variables = make(map[string]string, len(msg.Variables)+3)
+		for k, v := range msg.Variables {
+			signed.Variables[k] = v
+		}
+		signed.Variables[VariableSignatureKeyID] = key.ID()
+		signed.Variables[VariableSignatureAlgorithm] = key.Algorithm()
+
+		signature, err := key.Sign(signingPayload(signed.Topic, signed.Body, signed.Variables))
+		if err != nil {
+			return NewError(ErrCodePublish, "failed to sign message", err)
+		}
+		signed.Variables[VariableSignature] = base64.StdEncoding.EncodeToString(signature)
+		return next.Handle(ctx, &signed)
+	})
+}
+
+// verifySignature checks the signature of a received message and returns its status
+func (o *SigningOptions) verifySignature(msg *Message) string {
+	encoded, ok := msg.Variables[VariableSignature]
+	if !ok {
+		return SignatureStatusMissing
+	}
+	key := o.verifyKey(msg.Variables[VariableSignatureKeyID])
+	if key == nil || key.Algorithm() != msg.Variables[VariableSignatureAlgorithm] {
+		return SignatureStatusInvalid
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !key.Verify(signingPayload(msg.Topic, msg.Body, msg.Variables), signature) {
+		return SignatureStatusInvalid
+	}
+	return SignatureStatusValid
+}
+
+// verifyConsume is the built-in consume middleware that verifies message signatures
+// and applies the verify mode to messages with a missing or bad signature
+func (c *Client) verifyConsume(next Handler) Handler {
+	opts := c.config.Signing
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		status := opts.verifySignature(msg)
+		if msg.Variables == nil {
+			msg.Variables = make(map[string]string)
+		}
+		// Always overwrite the status, a producer could have set it
+		msg.Variables[VariableSignatureStatus] = status
+		if status == SignatureStatusValid || opts.Mode == VerifyFlag {
+			return next.Handle(ctx, msg)
+		}
+
+		reason := fmt.Sprintf("%s signature", status)
+		if opts.Mode == VerifyDeadLetter {
+			return c.deadLetter(ctx, msg, opts.DeadLetterTopic, reason)
+		}
+		return NewError(ErrCodeSignature, fmt.Sprintf("message %s has a %s", msg.UUID, reason), nil)
+	})
+}
+
+// deadLetterQueueSize is the number of dead letters waiting to be sent, above which they are rejected
+const deadLetterQueueSize = 100
+
+// deadLetter is a received message waiting to be sent to the dead-letter topic
+type deadLetter struct {
+	msg    *Message
+	reason string
+	req    *mqv1.PubMessageRequest
+}
+
+// deadLetterQueue holds the dead letters of a client; its goroutine runs while it is not empty
+type deadLetterQueue struct {
+	letters chan deadLetter
+	running atomic.Bool
+}
+
+// deadLetterQueue returns the dead-letter queue of the client, created on first use
+func (c *Client) deadLetterQueue() *deadLetterQueue {
+	c.deadLettersOnce.Do(func() {
+		c.deadLetters = &deadLetterQueue{letters: make(chan deadLetter, deadLetterQueueSize)}
+	})
+	return c.deadLetters
+}
+
+// deadLetter queues the message as received for the dead-letter topic and drops it.
+// The dead letter bypasses the publish middleware: it is not re-signed, so its original signature
+// does not verify on the dead-letter topic, nor compressed, encrypted or rate limited.
+// It is sent in the background, so that the subscription does not wait for it.
+func (c *Client) deadLetter(ctx context.Context, msg *Message, topic, reason string) error {
+	variables := make(map[string]string, len(msg.Variables)+2)
+	for k, v := range msg.Variables {
+		variables[k] = v
+	}
+	variables[VariableDeadLetterReason] = reason
+	variables[VariableDeadLetterTopic] = msg.Topic
+	letter := deadLetter{msg: msg, reason: reason, req: &mqv1.PubMessageRequest{Topic: topic, Body: msg.Body, Variables: variables}}
+
+	queue := c.deadLetterQueue()
+	select {
+	case queue.letters <- letter:
+	default:
+		return NewError(ErrCodeSignature, fmt.Sprintf("failed to dead-letter message %s with a %s: too many dead letters waiting", msg.UUID, reason), nil)
+	}
+	if queue.running.CompareAndSwap(false, true) {
+		go c.sendDeadLetters(queue)
+	}
+	return ErrSkipMessage
+}
+
+// sendDeadLetters sends the queued dead letters until the queue is empty
+func (c *Client) sendDeadLetters(queue *deadLetterQueue) {
+	for {
+		var letters []deadLetter
+	collect:
+		for len(letters) < deadLetterQueueSize {
+			select {
+			case letter := <-queue.letters:
+				letters = append(letters, letter)
+			default:
+				break collect
+			}
+		}
+		if len(letters) > 0 {
+			c.publishDeadLetters(letters)
+			continue
+		}
+
+		queue.running.Store(false)
+		// A letter queued before running was cleared did not start a goroutine
+		if len(queue.letters) == 0 || !queue.running.CompareAndSwap(false, true) {
+			return
+		}
+	}
+}
+
+// publishDeadLetters sends dead letters on their own publish stream
+func (c *Client) publishDeadLetters(letters []deadLetter) {
+	ctx := withOperation(context.Background(), opDeadLetter)
+	stream, err := c.client.PubMessage(ctx)
+	if err == nil {
+		for _, letter := range letters {
+			if err = stream.Send(letter.req); err != nil {
+				break
+			}
+		}
+		// The status of an aborted stream is reported by CloseAndRecv
+		if _, closeErr := stream.CloseAndRecv(); err == nil || err == io.EOF {
+			err = closeErr
+		}
+	}
+
+	for _, letter := range letters {
+		msg := letter.msg
+		if err != nil {
+			c.consumeError(ctx, msg, NewError(ErrCodeSignature,
+				fmt.Sprintf("failed to dead-letter message %s with a %s", msg.UUID, letter.reason),
+				c.wrapError(ctx, err, "failed to publish dead letter")))
+			continue
+		}
+		c.metrics().MessagePublished(letter.req.Topic, proto.Size(letter.req))
+		c.log(ctx).With(LogKeyTopic, msg.Topic, LogKeyUUID, msg.UUID).
+			Warn("Message with a %s sent to dead-letter topic %s", letter.reason, letter.req.Topic)
+	}
+}
@@ -0,0 +1,284 @@
+package togomq
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSigningKeys(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	data := []byte("payload")
+
+	for _, tc := range []struct {
+		signer, verifier SigningKey
+	}{
+		{NewHMACKey("h1", []byte("secret")), NewHMACKey("h1", []byte("secret"))},
+		{mustEd25519Key(t, "e1", private), NewEd25519PublicKey("e1", public)},
+	} {
+		t.Run(tc.signer.Algorithm(), func(t *testing.T) {
+			signature, err := tc.signer.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			if !tc.verifier.Verify(data, signature) {
+				t.Error("Expected the signature to verify")
+			}
+			if tc.verifier.Verify([]byte("tampered"), signature) {
+				t.Error("Expected a tampered payload not to verify")
+			}
+		})
+	}
+
+	if _, err := NewEd25519PublicKey("e1", public).Sign(data); err == nil {
+		t.Error("Expected error when signing with a public key")
+	}
+	if _, err := NewEd25519Key("e1", nil); err == nil {
+		t.Error("Expected error for a missing private key")
+	}
+}
+
+// mustEd25519Key creates an Ed25519 signing key or fails the test
+func mustEd25519Key(t *testing.T, id string, private ed25519.PrivateKey) SigningKey {
+	t.Helper()
+	key, err := NewEd25519Key(id, private)
+	if err != nil {
+		t.Fatalf("NewEd25519Key failed: %v", err)
+	}
+	return key
+}
+
+func TestSigningPayload_Canonical(t *testing.T) {
+	a := signingPayload("t", []byte("b"), map[string]string{"x": "1", "y": "2", VariableSignature: "s"})
+	b := signingPayload("t", []byte("b"), map[string]string{"y": "2", "x": "1"})
+	if !bytes.Equal(a, b) {
+		t.Error("Expected the payload to ignore variable order and the signature")
+	}
+	// Field boundaries are unambiguous
+	if bytes.Equal(signingPayload("ab", []byte("c"), nil), signingPayload("a", []byte("bc"), nil)) {
+		t.Error("Expected different payloads for different topic and body splits")
+	}
+}
+
+func TestSigning_RoundTrip(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(nil)
+	sign := func(c *Config) {
+		c.Signing = NewSigningOptions(mustEd25519Key(t, "e1", private))
+		c.Compression = CompressionGzip
+		c.CompressionThreshold = 0
+	}
+
+	msg := NewMessage("orders", bytes.Repeat([]byte("order;"), 50)).WithVariables(map[string]string{"k": "v"})
+	requests := publishRequests(t, sign, msg)
+
+	vars := requests[0].Variables
+	if vars[VariableSignatureKeyID] != "e1" || vars[VariableSignatureAlgorithm] != SignatureEd25519 || vars[VariableSignature] == "" {
+		t.Fatalf("Expected signature variables, got %v", vars)
+	}
+	if _, ok := msg.Variables[VariableSignature]; ok {
+		t.Error("Expected the published message to be unchanged")
+	}
+
+	delivered, rejected := replaySubscribe(t, sign, requests)
+	if len(rejected) != 0 || len(delivered) != 1 {
+		t.Fatalf("Expected 1 delivered message, got %d delivered and %v", len(delivered), rejected)
+	}
+	if delivered[0].Variables[VariableSignatureStatus] != SignatureStatusValid {
+		t.Errorf("Expected a valid signature status, got %v", delivered[0].Variables)
+	}
+	if !bytes.Equal(delivered[0].Body, msg.Body) || delivered[0].Variables["k"] != "v" {
+		t.Error("Expected the body and variables to be kept")
+	}
+}
+
+// tamperedRequests returns a valid, a tampered and an unsigned request
+func tamperedRequests(t *testing.T, key SigningKey) []*mqv1.PubMessageRequest {
+	t.Helper()
+	requests := publishRequests(t, func(c *Config) { c.Signing = NewSigningOptions(key) },
+		NewMessage("orders", []byte("valid")),
+		NewMessage("orders", []byte("tampered")).WithVariables(map[string]string{"amount": "10"}))
+	requests[1].Variables["amount"] = "1000"
+	unsigned := publishRequests(t, func(c *Config) {}, NewMessage("orders", []byte("unsigned")).
+		WithVariables(map[string]string{VariableSignatureStatus: SignatureStatusValid}))
+	return append(requests, unsigned...)
+}
+
+func TestSigning_VerifyModes(t *testing.T) {
+	key := NewHMACKey("h1", []byte("secret"))
+	requests := tamperedRequests(t, key)
+
+	t.Run("reject", func(t *testing.T) {
+		delivered, rejected := replaySubscribe(t, func(c *Config) { c.Signing = NewSigningOptions(key) }, requests)
+		if len(delivered) != 1 || string(delivered[0].Body) != "valid" {
+			t.Fatalf("Expected only the valid message, got %d", len(delivered))
+		}
+		if len(rejected) != 2 {
+			t.Fatalf("Expected 2 rejections, got %v", rejected)
+		}
+		for _, err := range rejected {
+			if decodeErrCode(err) != ErrCodeSignature {
+				t.Errorf("Expected a signature error, got %v", err)
+			}
+		}
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		delivered, rejected := replaySubscribe(t, func(c *Config) {
+			c.Signing = NewSigningOptions(key).WithMode(VerifyFlag)
+		}, requests)
+		if len(rejected) != 0 || len(delivered) != 3 {
+			t.Fatalf("Expected 3 delivered messages, got %d and %v", len(delivered), rejected)
+		}
+		// The status set by the producer of the unsigned message is overwritten
+		expected := map[string]string{
+			"valid":    SignatureStatusValid,
+			"tampered": SignatureStatusInvalid,
+			"unsigned": SignatureStatusMissing,
+		}
+		for _, msg := range delivered {
+			if got := msg.Variables[VariableSignatureStatus]; got != expected[string(msg.Body)] {
+				t.Errorf("Message %q: expected status %q, got %q", msg.Body, expected[string(msg.Body)], got)
+			}
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		other := NewHMACKey("h2", []byte("secret"))
+		_, rejected := replaySubscribe(t, func(c *Config) { c.Signing = NewSigningOptions(other) }, requests)
+		if len(rejected) != 3 {
+			t.Errorf("Expected all messages to be rejected, got %v", rejected)
+		}
+	})
+}
+
+func TestSigning_DeadLetter(t *testing.T) {
+	key := NewHMACKey("h1", []byte("secret"))
+	requests := tamperedRequests(t, key)
+
+	var mu sync.Mutex
+	var deadLetters []*mqv1.PubMessageRequest
+	srv := recordingPubServer(&mu, &deadLetters)
+	srv.subFunc = func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+		for i, r := range requests {
+			stream.Send(&mqv1.SubMessageResponse{Topic: r.Topic, Uuid: string(rune('0' + i)), Body: r.Body, Variables: r.Variables})
+		}
+		<-stream.Context().Done()
+		return nil
+	}
+	client := newTestClient(t, srv)
+	client.config.Signing = NewSigningOptions(key).WithDeadLetterTopic("orders.dlq")
+	// Dead letters are not rate limited, this limit would shed the second one
+	client.config.RateLimit = NewRateLimitOptions(0.001).WithBurst(1, 0).WithMode(RateLimitShed)
+
+	var rejected []error
+	client.config.ConsumeErrorHandler = func(msg *Message, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		rejected = append(rejected, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if msg := <-msgChan; msg == nil || string(msg.Body) != "valid" {
+		t.Fatalf("Expected the valid message, got %+v", msg)
+	}
+
+	for {
+		mu.Lock()
+		done := len(deadLetters) == 2
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for dead letters")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rejected) != 0 {
+		t.Errorf("Expected no rejections, got %v", rejected)
+	}
+	for _, dead := range deadLetters {
+		if dead.Topic != "orders.dlq" || dead.Variables[VariableDeadLetterTopic] != "orders" {
+			t.Errorf("Expected a dead letter from orders, got %s %v", dead.Topic, dead.Variables)
+		}
+		if dead.Variables[VariableDeadLetterReason] == "" {
+			t.Error("Expected a dead-letter reason")
+		}
+		// The dead letter is not re-signed by the client
+		msg := &Message{Topic: dead.Topic, Body: dead.Body, Variables: dead.Variables}
+		if status := client.config.Signing.verifySignature(msg); status == SignatureStatusValid {
+			t.Errorf("Expected the dead letter %q not to verify", dead.Body)
+		}
+	}
+	if tampered := deadLetters[0]; tampered.Variables[VariableSignature] != requests[1].Variables[VariableSignature] {
+		t.Errorf("Expected the original signature to be kept, got %v", tampered.Variables)
+	}
+}
+
+func TestSigning_DeadLetterFailure(t *testing.T) {
+	key := NewHMACKey("h1", []byte("secret"))
+	requests := tamperedRequests(t, key)
+
+	srv := &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			return status.Error(codes.PermissionDenied, "dead-letter topic is not writable")
+		},
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			r := requests[1]
+			stream.Send(&mqv1.SubMessageResponse{Topic: r.Topic, Uuid: "1", Body: r.Body, Variables: r.Variables})
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client := newTestClient(t, srv)
+	client.config.Signing = NewSigningOptions(key).WithDeadLetterTopic("orders.dlq")
+	rejected := make(chan error, 1)
+	client.config.ConsumeErrorHandler = func(msg *Message, err error) {
+		rejected <- err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, err := client.Sub(ctx, NewSubscribeOptions("orders")); err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	select {
+	case err := <-rejected:
+		if decodeErrCode(err) != ErrCodeSignature || !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("Expected a signature error caused by the dead letter, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for the dead letter to fail")
+	}
+}
+
+func TestConfig_ValidateSigning(t *testing.T) {
+	key := NewHMACKey("h1", []byte("secret"))
+	if err := NewConfig(WithToken("t"), WithSigning(NewSigningOptions(key).WithMode(VerifyDeadLetter))).Validate(); err == nil {
+		t.Error("Expected error without a dead-letter topic")
+	}
+	if err := NewConfig(WithToken("t"), WithSigning(NewSigningOptions(key).WithDeadLetterTopic("dlq"))).Validate(); err != nil {
+		t.Errorf("Expected valid options, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package togomq
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSOptions configures the TLS connection to the server.
+// Certificates and CA bundles read from files are reloaded when the files change,
+// so they can be rotated on disk without recreating the Client.
+type TLSOptions struct {
+	// CAFile is the path of a PEM CA bundle verifying the server (default: system roots)
+	CAFile string
+	// CAPEM is a PEM CA bundle verifying the server, used when CAFile is not set
+	CAPEM []byte
+	// CertFile is the path of the PEM client certificate for mutual TLS
+	CertFile string
+	// KeyFile is the path of the PEM private key of the client certificate
+	KeyFile string
+	// CertPEM is the PEM client certificate, used when CertFile is not set
+	CertPEM []byte
+	// KeyPEM is the PEM private key of the client certificate, used with CertPEM
+	KeyPEM []byte
+	// ServerName overrides the name the server certificate is verified against (default: Host)
+	ServerName string
+	// InsecureSkipVerify disables the verification of the server certificate, for development only
+	InsecureSkipVerify bool
+	// MinVersion is the minimum TLS version (default: TLS 1.2)
+	MinVersion uint16
+}
+
+// NewTLSOptions creates TLS options with default values
+func NewTLSOptions() *TLSOptions {
+	return &TLSOptions{
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// WithCAFile sets the path of the PEM CA bundle verifying the server
+func (o *TLSOptions) WithCAFile(path string) *TLSOptions {
+	o.CAFile = path
+	return o
+}
+
+// WithCAPEM sets the PEM CA bundle verifying the server
+func (o *TLSOptions) WithCAPEM(pem []byte) *TLSOptions {
+	o.CAPEM = pem
+	return o
+}
+
+// WithClientCertFile sets the paths of the PEM client certificate and key for mutual TLS
+func (o *TLSOptions) WithClientCertFile(certFile, keyFile string) *TLSOptions {
+	o.CertFile = certFile
+	o.KeyFile = keyFile
+	return o
+}
+
+// WithClientCertPEM sets the PEM client certificate and key for mutual TLS
+func (o *TLSOptions) WithClientCertPEM(certPEM, keyPEM []byte) *TLSOptions {
+	o.CertPEM = certPEM
+	o.KeyPEM = keyPEM
+	return o
+}
+
+// WithServerName overrides the name the server certificate is verified against
+func (o *TLSOptions) WithServerName(name string) *TLSOptions {
+	o.ServerName = name
+	return o
+}
+
+// WithInsecureSkipVerify disables the verification of the server certificate, for development only
+func (o *TLSOptions) WithInsecureSkipVerify(skip bool) *TLSOptions {
+	o.InsecureSkipVerify = skip
+	return o
+}
+
+// WithMinVersion sets the minimum TLS version, e.g. tls.VersionTLS13
+func (o *TLSOptions) WithMinVersion(version uint16) *TLSOptions {
+	o.MinVersion = version
+	return o
+}
+
+// validate checks if the TLS options are valid
+func (o *TLSOptions) validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return fmt.Errorf("TLS client certificate file and key file must be set together")
+	}
+	if (len(o.CertPEM) == 0) != (len(o.KeyPEM) == 0) {
+		return fmt.Errorf("TLS client certificate and key must be set together")
+	}
+	if o.MinVersion != 0 && (o.MinVersion < tls.VersionTLS10 || o.MinVersion > tls.VersionTLS13) {
+		return fmt.Errorf("unsupported minimum TLS version %#x", o.MinVersion)
+	}
+	return nil
+}
+
+// tlsLoader loads the certificates of TLS options and reloads the files when they change
+type tlsLoader struct {
+	opts   *TLSOptions
+	logger *Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	roots   *x509.CertPool
+	rootMod time.Time
+}
+
+// config builds the client TLS configuration; certificates are loaded once to report
+// errors early, then on each handshake when their files changed
+func (o *TLSOptions) config(logger *Logger) (*tls.Config, error) {
+	l := &tlsLoader{opts: o, logger: logger}
+	cfg := &tls.Config{
+		ServerName: o.ServerName,
+		MinVersion: o.MinVersion,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	if o.CertFile != "" || len(o.CertPEM) > 0 {
+		if _, err := l.certificate(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return l.certificate()
+		}
+	}
+
+	switch {
+	case o.InsecureSkipVerify:
+		cfg.InsecureSkipVerify = true
+	case o.CAFile != "" || len(o.CAPEM) > 0:
+		if _, err := l.rootCAs(); err != nil {
+			return nil, err
+		}
+		// The server certificate is verified by verifyConnection against the current CA bundle
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = l.verifyConnection
+	}
+	return cfg, nil
+}
+
+// certificate returns the client certificate, reloading the files when they changed.
+// A file that fails to reload keeps the previous certificate in use.
+func (l *tlsLoader) certificate() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.CertFile == "" {
+		if l.cert == nil {
+			cert, err := tls.X509KeyPair(l.opts.CertPEM, l.opts.KeyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TLS client certificate: %w", err)
+			}
+			l.cert = &cert
+		}
+		return l.cert, nil
+	}
+
+	mod, err := modTime(l.opts.CertFile, l.opts.KeyFile)
+	if err == nil && l.cert != nil && !mod.After(l.certMod) {
+		return l.cert, nil
+	}
+	var cert tls.Certificate
+	if err == nil {
+		cert, err = tls.LoadX509KeyPair(l.opts.CertFile, l.opts.KeyFile)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to load TLS client certificate %s: %w", l.opts.CertFile, err)
+		if l.cert == nil {
+			return nil, err
+		}
+		l.logger.WithError(err).Warn("Keeping the previous TLS client certificate")
+		return l.cert, nil
+	}
+	if l.cert != nil {
+		l.logger.With("file", l.opts.CertFile).Info("Reloaded TLS client certificate")
+	}
+	l.cert, l.certMod = &cert, mod
+	return l.cert, nil
+}
+
+// rootCAs returns the CA bundle, reloading the file when it changed.
+// A file that fails to reload keeps the previous bundle in use.
+func (l *tlsLoader) rootCAs() (*x509.CertPool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.CAFile == "" {
+		if l.roots == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(l.opts.CAPEM) {
+				return nil, fmt.Errorf("invalid TLS CA bundle: no certificate found")
+			}
+			l.roots = pool
+		}
+		return l.roots, nil
+	}
+
+	mod, err := modTime(l.opts.CAFile)
+	if err == nil && l.roots != nil && !mod.After(l.rootMod) {
+		return l.roots, nil
+	}
+	var pem []byte
+	if err == nil {
+		pem, err = os.ReadFile(l.opts.CAFile)
+	}
+	pool := x509.NewCertPool()
+	if err == nil && !pool.AppendCertsFromPEM(pem) {
+		err = errors.New("no certificate found")
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to load TLS CA bundle %s: %w", l.opts.CAFile, err)
+		if l.roots == nil {
+			return nil, err
+		}
+		l.logger.WithError(err).Warn("Keeping the previous TLS CA bundle")
+		return l.roots, nil
+	}
+	if l.roots != nil {
+		l.logger.With("file", l.opts.CAFile).Info("Reloaded TLS CA bundle")
+	}
+	l.roots, l.rootMod = pool, mod
+	return l.roots, nil
+}
+
+// verifyConnection verifies the server certificate chain against the current CA bundle and the
+// server name of the connection. A connection without server name is rejected.
+func (l *tlsLoader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	if cs.ServerName == "" {
+		return errors.New("no server name to verify the server certificate against")
+	}
+	roots, err := l.rootCAs()
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// credentials returns the transport credentials of the TLS options
+func (o *TLSOptions) credentials(logger *Logger) (credentials.TransportCredentials, error) {
+	cfg, err := o.config(logger)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsCredentials{TransportCredentials: credentials.NewTLS(cfg), cfg: cfg}, nil
+}
+
+// tlsCredentials are TLS transport credentials that verify the server certificate against the
+// dialed host. The TLS connection state only holds the server name sent with SNI, which is empty
+// for IP addresses.
+type tlsCredentials struct {
+	credentials.TransportCredentials
+	cfg *tls.Config
+}
+
+// ClientHandshake runs the TLS handshake with the server at authority
+func (c *tlsCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	verify := c.cfg.VerifyConnection
+	if verify == nil {
+		return c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	}
+
+	name := c.cfg.ServerName
+	if name == "" {
+		host, _, err := net.SplitHostPort(authority)
+		if err != nil {
+			host = authority
+		}
+		name = host
+	}
+	cfg := c.cfg.Clone()
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		cs.ServerName = name
+		return verify(cs)
+	}
+	return credentials.NewTLS(cfg).ClientHandshake(ctx, authority, conn)
+}
+
+// Clone returns a copy of the credentials
+func (c *tlsCredentials) Clone() credentials.TransportCredentials {
+	return &tlsCredentials{TransportCredentials: c.TransportCredentials.Clone(), cfg: c.cfg.Clone()}
+}
+
+// modTime returns the latest modification time of the files
+func modTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
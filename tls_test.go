@@ -0,0 +1,310 @@
+package togomq
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// testCert is a certificate with its key, in PEM and parsed forms
+type testCert struct {
+	certPEM, keyPEM []byte
+	cert            *x509.Certificate
+	key             *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate signed by parent, or a self-signed CA when parent is nil
+func newTestCert(t *testing.T, parent *testCert, serial int64, name string) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.DNSNames, template.IPAddresses = nil, []net.IP{ip}
+	}
+	issuer, signer := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		issuer, signer = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		cert:    cert,
+		key:     key,
+	}
+}
+
+// handshake runs a TLS handshake between a client with cfg and a server with the certificate
+// that requires client certificates issued by clientCA, and returns the client certificate seen by the server
+func handshake(t *testing.T, cfg *tls.Config, server, clientCA *testCert) (*x509.Certificate, error) {
+	t.Helper()
+
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair failed: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	srv := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	done := make(chan *x509.Certificate, 1)
+	go func() {
+		defer close(done)
+		if srv.Handshake() == nil {
+			done <- srv.ConnectionState().PeerCertificates[0]
+		}
+		serverConn.Close()
+	}()
+
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = "togomq.test"
+	}
+	client := tls.Client(clientConn, cfg)
+	if err := client.Handshake(); err != nil {
+		return nil, err
+	}
+	return <-done, nil
+}
+
+// dialHandshake runs the client handshake of creds with a server at authority presenting the certificate
+func dialHandshake(t *testing.T, creds credentials.TransportCredentials, authority string, server *testCert) error {
+	t.Helper()
+
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair failed: %v", err)
+	}
+	// A TCP connection buffers the server flight, which the client may reject before reading it all
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer lis.Close()
+	go func() {
+		if conn, err := lis.Accept(); err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err = creds.ClientHandshake(ctx, authority, conn)
+	return err
+}
+
+// writeFile writes data to a file with the modification time mod, so reloads see a change
+func writeFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+}
+
+func TestTLSOptions_MutualTLS(t *testing.T) {
+	ca := newTestCert(t, nil, 1, "ca")
+	server := newTestCert(t, ca, 2, "togomq.test")
+	client := newTestCert(t, ca, 3, "client")
+
+	cfg, err := NewTLSOptions().WithCAPEM(ca.certPEM).WithClientCertPEM(client.certPEM, client.keyPEM).config(NewLogger(LogLevelNone))
+	if err != nil {
+		t.Fatalf("config failed: %v", err)
+	}
+	peer, err := handshake(t, cfg, server, ca)
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if peer == nil || peer.SerialNumber.Int64() != 3 {
+		t.Errorf("Expected the server to see client certificate 3, got %v", peer)
+	}
+
+	// A server certificate from another CA is rejected, unless verification is skipped
+	other := newTestCert(t, nil, 4, "other")
+	untrusted := newTestCert(t, other, 5, "togomq.test")
+	if _, err := handshake(t, cfg, untrusted, ca); err == nil {
+		t.Error("Expected an untrusted server certificate to be rejected")
+	}
+	insecure, _ := NewTLSOptions().WithInsecureSkipVerify(true).WithClientCertPEM(client.certPEM, client.keyPEM).
+		config(NewLogger(LogLevelNone))
+	if _, err := handshake(t, insecure, untrusted, ca); err != nil {
+		t.Errorf("Expected the handshake to succeed without verification, got %v", err)
+	}
+
+	// The server name override is verified against the certificate
+	mismatch, _ := NewTLSOptions().WithCAPEM(ca.certPEM).WithServerName("wrong.test").
+		WithClientCertPEM(client.certPEM, client.keyPEM).config(NewLogger(LogLevelNone))
+	if _, err := handshake(t, mismatch, server, ca); err == nil {
+		t.Error("Expected a server name mismatch to be rejected")
+	}
+}
+
+func TestTLSOptions_IPEndpoint(t *testing.T) {
+	ca := newTestCert(t, nil, 1, "ca")
+	creds, err := NewTLSOptions().WithCAPEM(ca.certPEM).credentials(NewLogger(LogLevelNone))
+	if err != nil {
+		t.Fatalf("credentials failed: %v", err)
+	}
+
+	// Without SNI for an IP address, the certificate is verified against the dialed IP
+	if err := dialHandshake(t, creds, "10.0.0.5:5123", newTestCert(t, ca, 2, "other.example")); err == nil {
+		t.Error("Expected a certificate for another host to be rejected for an IP endpoint")
+	}
+	if err := dialHandshake(t, creds, "10.0.0.5:5123", newTestCert(t, ca, 3, "10.0.0.5")); err != nil {
+		t.Errorf("Expected a certificate for the dialed IP to be accepted, got %v", err)
+	}
+	if err := dialHandshake(t, creds, "mq.example:5123", newTestCert(t, ca, 4, "mq.example")); err != nil {
+		t.Errorf("Expected a certificate for the dialed host to be accepted, got %v", err)
+	}
+
+	// A connection without server name fails closed
+	cfg, _ := NewTLSOptions().WithCAPEM(ca.certPEM).config(NewLogger(LogLevelNone))
+	if err := cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{ca.cert}}); err == nil {
+		t.Error("Expected a connection without server name to be rejected")
+	}
+}
+
+func TestTLSOptions_HotReload(t *testing.T) {
+	ca := newTestCert(t, nil, 1, "ca")
+	server := newTestCert(t, ca, 2, "togomq.test")
+	client := newTestCert(t, ca, 3, "client")
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	now := time.Now()
+	writeFile(t, caFile, ca.certPEM, now)
+	writeFile(t, certFile, client.certPEM, now)
+	writeFile(t, keyFile, client.keyPEM, now)
+
+	cfg, err := NewTLSOptions().WithCAFile(caFile).WithClientCertFile(certFile, keyFile).config(NewLogger(LogLevelNone))
+	if err != nil {
+		t.Fatalf("config failed: %v", err)
+	}
+	if peer, err := handshake(t, cfg, server, ca); err != nil || peer.SerialNumber.Int64() != 3 {
+		t.Fatalf("Expected client certificate 3, got %v (%v)", peer, err)
+	}
+
+	// Rotate the client certificate on disk
+	rotated := newTestCert(t, ca, 6, "client")
+	later := now.Add(time.Minute)
+	writeFile(t, certFile, rotated.certPEM, later)
+	writeFile(t, keyFile, rotated.keyPEM, later)
+	if peer, err := handshake(t, cfg, server, ca); err != nil || peer.SerialNumber.Int64() != 6 {
+		t.Errorf("Expected the rotated client certificate 6, got %v (%v)", peer, err)
+	}
+
+	// A broken file keeps the previous certificate in use
+	writeFile(t, certFile, []byte("garbage"), later.Add(time.Minute))
+	if peer, err := handshake(t, cfg, server, ca); err != nil || peer.SerialNumber.Int64() != 6 {
+		t.Errorf("Expected the previous client certificate 6, got %v (%v)", peer, err)
+	}
+
+	// Rotate the CA bundle to a new CA issuing the server certificate
+	newCA := newTestCert(t, nil, 7, "ca2")
+	newServer := newTestCert(t, newCA, 8, "togomq.test")
+	if _, err := handshake(t, cfg, newServer, ca); err == nil {
+		t.Error("Expected the server certificate of the new CA to be rejected before the rotation")
+	}
+	writeFile(t, caFile, append(ca.certPEM, newCA.certPEM...), later)
+	if _, err := handshake(t, cfg, newServer, ca); err != nil {
+		t.Errorf("Expected the server certificate of the new CA to be trusted, got %v", err)
+	}
+}
+
+func TestTLSOptions_LoadErrors(t *testing.T) {
+	logger := NewLogger(LogLevelNone)
+	if _, err := NewTLSOptions().WithCAFile("/nonexistent/ca.pem").config(logger); err == nil {
+		t.Error("Expected error for a missing CA file")
+	}
+	if _, err := NewTLSOptions().WithCAPEM([]byte("garbage")).config(logger); err == nil {
+		t.Error("Expected error for an invalid CA bundle")
+	}
+	if _, err := NewTLSOptions().WithClientCertPEM([]byte("garbage"), []byte("garbage")).config(logger); err == nil {
+		t.Error("Expected error for an invalid client certificate")
+	}
+}
+
+func TestConfig_ValidateTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ConfigOption
+		wantErr bool
+	}{
+		{"valid", []ConfigOption{WithTLS(NewTLSOptions().WithClientCertFile("c.pem", "k.pem"))}, false},
+		{"cert without key", []ConfigOption{WithTLS(NewTLSOptions().WithClientCertFile("c.pem", ""))}, true},
+		{"pem without key", []ConfigOption{WithTLS(NewTLSOptions().WithClientCertPEM([]byte("c"), nil))}, true},
+		{"unsupported version", []ConfigOption{WithTLS(NewTLSOptions().WithMinVersion(0x0200))}, true},
+		{"TLS disabled", []ConfigOption{WithTLS(NewTLSOptions()), WithUseTLS(false)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ConfigOption{WithToken("t")}, tt.opts...)
+			if err := NewConfig(opts...).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClient_InvalidTLS(t *testing.T) {
+	_, err := NewClient(NewConfig(WithToken("t"), WithTLS(NewTLSOptions().WithCAFile("/nonexistent/ca.pem"))))
+	if decodeErrCode(err) != ErrCodeConfiguration {
+		t.Errorf("Expected a configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package togomqprom exports the measurements of the TogoMQ SDK as Prometheus metrics.
+//
+// Messages and bytes are labelled by topic; avoid it with topics of unbounded cardinality.
+package togomqprom
+
+import (
+	"time"
+
+	togomq "github.com/TogoMQ/togomq-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is the prefix of the metric names
+const Namespace = "togomq"
+
+// Metrics is a togomq.Metrics that records the measurements in Prometheus collectors
+type Metrics struct {
+	messagesPublished   *prometheus.CounterVec
+	messagesReceived    *prometheus.CounterVec
+	bytesSent           *prometheus.CounterVec
+	bytesReceived       *prometheus.CounterVec
+	publishLatency      *prometheus.HistogramVec
+	errors              *prometheus.CounterVec
+	activeSubscriptions *prometheus.GaugeVec
+	reconnects          *prometheus.CounterVec
+	rateLimited         *prometheus.CounterVec
+	subscriptionRate    *prometheus.GaugeVec
+}
+
+var (
+	_ togomq.Metrics            = (*Metrics)(nil)
+	_ togomq.RateLimitMetrics   = (*Metrics)(nil)
+	_ togomq.FlowControlMetrics = (*Metrics)(nil)
+)
+
+// New creates the collectors and registers them with reg
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		messagesPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_published_total",
+			Help:      "Number of messages sent on publish streams.",
+		}, []string{"topic"}),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "messages_received_total",
+			Help:      "Number of messages received on subscribe streams.",
+		}, []string{"topic"}),
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_sent_total",
+			Help:      "Size of the published messages on the wire.",
+		}, []string{"topic"}),
+		bytesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_received_total",
+			Help:      "Size of the received messages on the wire.",
+		}, []string{"topic"}),
+		publishLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "publish_stream_duration_seconds",
+			Help:      "Time from opening a publish stream to its acknowledgement or failure.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "errors_total",
+			Help:      "Number of failed calls to the server by error code.",
+		}, []string{"operation", "code"}),
+		activeSubscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "active_subscriptions",
+			Help:      "Number of running subscriptions.",
+		}, []string{"topic"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "reconnects_total",
+			Help:      "Number of attempts to re-open a lost subscription.",
+		}, []string{"topic"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "rate_limited_total",
+			Help:      "Number of published messages that exceeded a rate limit by mode.",
+		}, []string{"topic", "mode"}),
+		subscriptionRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "subscription_rate",
+			Help:      "Messages per second delivered by subscriptions with flow control.",
+		}, []string{"topic"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.messagesPublished,
+		m.messagesReceived,
+		m.bytesSent,
+		m.bytesReceived,
+		m.publishLatency,
+		m.errors,
+		m.activeSubscriptions,
+		m.reconnects,
+		m.rateLimited,
+		m.subscriptionRate,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// MessagePublished counts a published message and its size
+func (m *Metrics) MessagePublished(topic string, bytes int) {
+	m.messagesPublished.WithLabelValues(topic).Inc()
+	m.bytesSent.WithLabelValues(topic).Add(float64(bytes))
+}
+
+// MessageReceived counts a received message and its size
+func (m *Metrics) MessageReceived(topic string, bytes int) {
+	m.messagesReceived.WithLabelValues(topic).Inc()
+	m.bytesReceived.WithLabelValues(topic).Add(float64(bytes))
+}
+
+// PublishLatency observes the duration of a publish stream
+func (m *Metrics) PublishLatency(operation string, d time.Duration) {
+	m.publishLatency.WithLabelValues(operation).Observe(d.Seconds())
+}
+
+// Error counts a failed call
+func (m *Metrics) Error(operation string, code string) {
+	m.errors.WithLabelValues(operation, code).Inc()
+}
+
+// SubscriptionStarted increments the active subscriptions
+func (m *Metrics) SubscriptionStarted(topic string) {
+	m.activeSubscriptions.WithLabelValues(topic).Inc()
+}
+
+// SubscriptionStopped decrements the active subscriptions
+func (m *Metrics) SubscriptionStopped(topic string) {
+	m.activeSubscriptions.WithLabelValues(topic).Dec()
+}
+
+// Reconnect counts a reconnection attempt
+func (m *Metrics) Reconnect(topic string) {
+	m.reconnects.WithLabelValues(topic).Inc()
+}
+
+// RateLimited counts a message that exceeded a rate limit
+func (m *Metrics) RateLimited(topic string, mode string) {
+	m.rateLimited.WithLabelValues(topic, mode).Inc()
+}
+
+// SubscriptionRate sets the delivery rate of a subscription
+func (m *Metrics) SubscriptionRate(topic string, messagesPerSec float64) {
+	m.subscriptionRate.WithLabelValues(topic).Set(messagesPerSec)
+}
@@ -0,0 +1,84 @@
+package togomqprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	m.MessagePublished("orders", 10)
+	m.MessagePublished("orders", 5)
+	m.MessageReceived("orders", 7)
+	m.PublishLatency("PubBatch", 20*time.Millisecond)
+	m.Error("Sub", "CONNECTION_ERROR")
+	m.SubscriptionStarted("orders")
+	m.SubscriptionStarted("orders")
+	m.SubscriptionStopped("orders")
+	m.Reconnect("orders")
+	m.RateLimited("orders", "shed")
+	m.SubscriptionRate("orders", 12.5)
+
+	expected := `
+# HELP togomq_active_subscriptions Number of running subscriptions.
+# TYPE togomq_active_subscriptions gauge
+togomq_active_subscriptions{topic="orders"} 1
+# HELP togomq_bytes_sent_total Size of the published messages on the wire.
+# TYPE togomq_bytes_sent_total counter
+togomq_bytes_sent_total{topic="orders"} 15
+# HELP togomq_errors_total Number of failed calls to the server by error code.
+# TYPE togomq_errors_total counter
+togomq_errors_total{code="CONNECTION_ERROR",operation="Sub"} 1
+# HELP togomq_messages_published_total Number of messages sent on publish streams.
+# TYPE togomq_messages_published_total counter
+togomq_messages_published_total{topic="orders"} 2
+# HELP togomq_messages_received_total Number of messages received on subscribe streams.
+# TYPE togomq_messages_received_total counter
+togomq_messages_received_total{topic="orders"} 1
+# HELP togomq_rate_limited_total Number of published messages that exceeded a rate limit by mode.
+# TYPE togomq_rate_limited_total counter
+togomq_rate_limited_total{mode="shed",topic="orders"} 1
+# HELP togomq_reconnects_total Number of attempts to re-open a lost subscription.
+# TYPE togomq_reconnects_total counter
+togomq_reconnects_total{topic="orders"} 1
+# HELP togomq_subscription_rate Messages per second delivered by subscriptions with flow control.
+# TYPE togomq_subscription_rate gauge
+togomq_subscription_rate{topic="orders"} 12.5
+`
+	names := []string{
+		"togomq_active_subscriptions",
+		"togomq_bytes_sent_total",
+		"togomq_errors_total",
+		"togomq_messages_published_total",
+		"togomq_messages_received_total",
+		"togomq_rate_limited_total",
+		"togomq_reconnects_total",
+		"togomq_subscription_rate",
+	}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+
+	if count := testutil.CollectAndCount(reg, "togomq_publish_stream_duration_seconds"); count != 1 {
+		t.Errorf("Expected 1 latency series, got %d", count)
+	}
+}
+
+func TestNew_DuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := New(reg); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, err := New(reg); err == nil {
+		t.Error("Expected error when registering twice")
+	}
+}
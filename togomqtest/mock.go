@@ -0,0 +1,211 @@
+package togomqtest
+
+import (
+	"context"
+	"sync"
+
+	togomq "github.com/TogoMQ/togomq-sdk-go"
+)
+
+// SubScript scripts the outcome of a call to MockQueue.Sub
+type SubScript struct {
+	// Err is returned by Sub instead of starting the subscription
+	Err error
+	// Messages are delivered in order on the message channel
+	Messages []*togomq.Message
+	// StreamErr is sent on the error channel after the messages, then both channels are closed
+	StreamErr error
+	// End closes both channels after the messages, like a stream ended by the server.
+	// Otherwise they stay open until the context is done.
+	End bool
+}
+
+// MockQueue is a togomq.MessageQueue that records published messages and subscriptions
+// and returns scripted results. It is safe for concurrent use.
+type MockQueue struct {
+	mu            sync.Mutex
+	published     []*togomq.Message
+	subscriptions []*togomq.SubscribeOptions
+	subScripts    []SubScript
+	counts        map[string]int64
+	faults        map[string][]error
+	closed        bool
+}
+
+var _ togomq.MessageQueue = (*MockQueue)(nil)
+
+// NewMockQueue creates an empty MockQueue
+func NewMockQueue() *MockQueue {
+	return &MockQueue{
+		counts: make(map[string]int64),
+		faults: make(map[string][]error),
+	}
+}
+
+// FailNext makes the next times calls to method return err. MethodPubMessage covers
+// Pub and PubBatch, MethodSubMessage covers Sub and MethodCountMessages covers CountMessages.
+func (m *MockQueue) FailNext(method string, err error, times int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < times; i++ {
+		m.faults[method] = append(m.faults[method], err)
+	}
+}
+
+// OnSub queues the scripts used by the next calls to Sub, one per call.
+// Without a script, Sub delivers nothing until the context is done.
+func (m *MockQueue) OnSub(scripts ...SubScript) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subScripts = append(m.subScripts, scripts...)
+}
+
+// SetCount sets the value returned by CountMessages for the topic.
+// Without it, CountMessages returns the number of published messages matching the topic.
+func (m *MockQueue) SetCount(topic string, count int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[topic] = count
+}
+
+// Published returns the messages published so far, in order
+func (m *MockQueue) Published() []*togomq.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*togomq.Message{}, m.published...)
+}
+
+// Subscriptions returns the options of the calls to Sub so far, in order
+func (m *MockQueue) Subscriptions() []*togomq.SubscribeOptions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*togomq.SubscribeOptions{}, m.subscriptions...)
+}
+
+// Closed reports whether Close was called
+func (m *MockQueue) Closed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// Pub records the messages read from the channel until it is closed
+func (m *MockQueue) Pub(ctx context.Context, messages <-chan *togomq.Message) (*togomq.PubResponse, error) {
+	if err := m.fault(MethodPubMessage); err != nil {
+		return &togomq.PubResponse{}, err
+	}
+
+	resp := &togomq.PubResponse{}
+	for msg := range messages {
+		m.record(msg)
+		resp.MessagesSent++
+		resp.FirstUnsentIndex++
+	}
+	resp.MessagesReceived = int64(resp.MessagesSent)
+	return resp, nil
+}
+
+// PubBatch records the messages
+func (m *MockQueue) PubBatch(ctx context.Context, messages []*togomq.Message) (*togomq.PubResponse, error) {
+	if err := m.fault(MethodPubMessage); err != nil {
+		return &togomq.PubResponse{Unsent: messages}, err
+	}
+
+	for _, msg := range messages {
+		m.record(msg)
+	}
+	return &togomq.PubResponse{
+		MessagesReceived: int64(len(messages)),
+		MessagesSent:     len(messages),
+		FirstUnsentIndex: len(messages),
+	}, nil
+}
+
+// Sub records the subscription and plays the next script
+func (m *MockQueue) Sub(ctx context.Context, opts *togomq.SubscribeOptions) (<-chan *togomq.Message, <-chan error, error) {
+	if err := m.fault(MethodSubMessage); err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	m.subscriptions = append(m.subscriptions, opts)
+	var script SubScript
+	if len(m.subScripts) > 0 {
+		script, m.subScripts = m.subScripts[0], m.subScripts[1:]
+	}
+	m.mu.Unlock()
+
+	if script.Err != nil {
+		return nil, nil, script.Err
+	}
+
+	messageChan := make(chan *togomq.Message)
+	errorChan := make(chan error, 1)
+	go func() {
+		defer close(messageChan)
+		defer close(errorChan)
+
+		for _, msg := range script.Messages {
+			select {
+			case messageChan <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if script.StreamErr != nil {
+			errorChan <- script.StreamErr
+			return
+		}
+		if !script.End {
+			<-ctx.Done()
+		}
+	}()
+	return messageChan, errorChan, nil
+}
+
+// CountMessages returns the count set for the topic, or the number of published
+// messages matching it
+func (m *MockQueue) CountMessages(ctx context.Context, topic string) (int64, error) {
+	if err := m.fault(MethodCountMessages); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if count, ok := m.counts[topic]; ok {
+		return count, nil
+	}
+	var count int64
+	for _, msg := range m.published {
+		if MatchTopic(topic, msg.Topic) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Close records that the queue was closed
+func (m *MockQueue) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// record adds a published message
+func (m *MockQueue) record(msg *togomq.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published = append(m.published, msg)
+}
+
+// fault consumes an injected error for the method
+func (m *MockQueue) fault(method string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if faults := m.faults[method]; len(faults) > 0 {
+		m.faults[method] = faults[1:]
+		return faults[0]
+	}
+	return nil
+}
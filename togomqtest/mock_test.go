@@ -0,0 +1,174 @@
+package togomqtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	togomq "github.com/TogoMQ/togomq-sdk-go"
+)
+
+// publishOrder is an example of code under test that depends on the interface
+func publishOrder(ctx context.Context, q togomq.MessageQueue, id string) error {
+	msg := togomq.NewMessage("orders.created", []byte(id)).WithVariables(map[string]string{"id": id})
+	_, err := q.PubBatch(ctx, []*togomq.Message{msg})
+	return err
+}
+
+func TestMockQueue_RecordsPublished(t *testing.T) {
+	mock := NewMockQueue()
+	ctx := context.Background()
+
+	if err := publishOrder(ctx, mock, "42"); err != nil {
+		t.Fatalf("publishOrder failed: %v", err)
+	}
+
+	msgChan := make(chan *togomq.Message, 1)
+	msgChan <- togomq.NewMessage("events.created", []byte("e"))
+	close(msgChan)
+	resp, err := mock.Pub(ctx, msgChan)
+	if err != nil || resp.MessagesSent != 1 {
+		t.Fatalf("Expected Pub to send 1 message, got %+v, %v", resp, err)
+	}
+
+	published := mock.Published()
+	if len(published) != 2 || published[0].Variables["id"] != "42" || published[1].Topic != "events.created" {
+		t.Fatalf("Unexpected published messages: %+v", published)
+	}
+
+	count, err := mock.CountMessages(ctx, "orders.*")
+	if err != nil || count != 1 {
+		t.Errorf("Expected 1 published order, got %d, %v", count, err)
+	}
+
+	mock.SetCount("orders.*", 10)
+	if count, _ := mock.CountMessages(ctx, "orders.*"); count != 10 {
+		t.Errorf("Expected the scripted count, got %d", count)
+	}
+}
+
+func TestMockQueue_FailNext(t *testing.T) {
+	mock := NewMockQueue()
+	errDown := errors.New("down")
+	mock.FailNext(MethodPubMessage, errDown, 1)
+
+	if err := publishOrder(context.Background(), mock, "1"); !errors.Is(err, errDown) {
+		t.Fatalf("Expected injected error, got %v", err)
+	}
+	if err := publishOrder(context.Background(), mock, "2"); err != nil {
+		t.Fatalf("Expected the fault to be consumed, got %v", err)
+	}
+	if published := mock.Published(); len(published) != 1 {
+		t.Errorf("Expected only the second message to be recorded, got %d", len(published))
+	}
+}
+
+func TestMockQueue_ScriptedSub(t *testing.T) {
+	mock := NewMockQueue()
+	errLost := errors.New("stream lost")
+	errRefused := errors.New("refused")
+	mock.OnSub(
+		SubScript{
+			Messages:  []*togomq.Message{{Topic: "orders", UUID: "1"}, {Topic: "orders", UUID: "2"}},
+			StreamErr: errLost,
+		},
+		SubScript{Err: errRefused},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, errChan, err := mock.Sub(ctx, togomq.NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	var uuids []string
+	for msg := range msgChan {
+		uuids = append(uuids, msg.UUID)
+	}
+	if len(uuids) != 2 || uuids[0] != "1" || uuids[1] != "2" {
+		t.Errorf("Expected messages 1 and 2, got %v", uuids)
+	}
+	if err := <-errChan; !errors.Is(err, errLost) {
+		t.Errorf("Expected stream error, got %v", err)
+	}
+
+	if _, _, err := mock.Sub(ctx, togomq.NewSubscribeOptions("events")); !errors.Is(err, errRefused) {
+		t.Errorf("Expected scripted start error, got %v", err)
+	}
+
+	subs := mock.Subscriptions()
+	if len(subs) != 2 || subs[0].Topic != "orders" || subs[1].Topic != "events" {
+		t.Errorf("Unexpected subscriptions: %+v", subs)
+	}
+}
+
+func TestMockQueue_UnscriptedSubWaitsForContext(t *testing.T) {
+	mock := NewMockQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	msgChan, _, err := mock.Sub(ctx, togomq.NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	select {
+	case msg := <-msgChan:
+		t.Fatalf("Expected no message, got %+v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	if _, ok := <-msgChan; ok {
+		t.Error("Expected the channel to be closed after cancellation")
+	}
+
+	mock.Close()
+	if !mock.Closed() {
+		t.Error("Expected Closed to report true")
+	}
+}
+
+func TestMockQueue_SubscribeTypedDecodeErrors(t *testing.T) {
+	type order struct {
+		ID string `json:"id"`
+	}
+	vars := map[string]string{togomq.VariableContentType: togomq.ContentTypeJSON}
+	mock := NewMockQueue()
+	mock.OnSub(SubScript{
+		Messages: []*togomq.Message{
+			{Topic: "orders", UUID: "1", Body: []byte(`{"id":"1"}`), Variables: vars},
+			{Topic: "orders", UUID: "2", Body: []byte(`{"id":`), Variables: vars},
+		},
+		End: true,
+	})
+
+	var failed []string
+	onDecodeError := func(msg *togomq.Message, err error) {
+		var tmqErr *togomq.TogoMQError
+		if errors.As(err, &tmqErr) && tmqErr.Code == togomq.ErrCodeDecode {
+			failed = append(failed, msg.UUID)
+		}
+	}
+	msgChan, errChan, err := togomq.SubscribeTyped[order](context.Background(), mock, togomq.NewSubscribeOptions("orders"), onDecodeError)
+	if err != nil {
+		t.Fatalf("SubscribeTyped failed: %v", err)
+	}
+
+	var ids []string
+	for msg := range msgChan {
+		ids = append(ids, msg.Value.ID)
+	}
+	if err, ok := <-errChan; ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("Expected order 1, got %v", ids)
+	}
+	// The handler runs before the channels are closed
+	if len(failed) != 1 || failed[0] != "2" {
+		t.Errorf("Expected the decode error of message 2, got %v", failed)
+	}
+}
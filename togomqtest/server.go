@@ -0,0 +1,407 @@
+// Package togomqtest provides an in-process TogoMQ server for testing code that uses togomq.Client.
+//
+// The server keeps messages in memory and serves them over an in-memory listener, so tests
+// need neither a network nor a real TogoMQ server:
+//
+//	srv, client := togomqtest.NewClient(t)
+//	client.PubBatch(ctx, []*togomq.Message{togomq.NewMessage("orders", body)})
+//	msgChan, errChan, err := client.Sub(ctx, togomq.NewSubscribeOptions("orders.*"))
+package togomqtest
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	togomq "github.com/TogoMQ/togomq-sdk-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Names of the service methods, used for fault injection
+const (
+	MethodPubMessage    = "PubMessage"
+	MethodSubMessage    = "SubMessage"
+	MethodCountMessages = "CountMessages"
+)
+
+// DefaultToken is the token used by clients created by the server when none is configured
+const DefaultToken = "togomqtest-token"
+
+// listenerBufferSize is the buffer size of the in-memory listener
+const listenerBufferSize = 1024 * 1024
+
+// Option is a function that modifies a Server
+type Option func(*Server)
+
+// WithToken makes the server reject calls that do not carry the token with Unauthenticated
+func WithToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// storedMessage is a message waiting to be delivered
+type storedMessage struct {
+	uuid        string
+	topic       string
+	body        []byte
+	variables   map[string]string
+	availableAt time.Time
+	expiresAt   time.Time // zero = kept until delivered
+}
+
+// Server is an in-memory implementation of the TogoMQ service.
+//
+// Published messages are stored until delivered to one subscriber whose topic pattern matches.
+// Postponed messages are delivered once their delay has elapsed and messages with a retention
+// are dropped when it expires; Advance moves the server clock forward to test both without sleeping.
+type Server struct {
+	mqv1.UnimplementedMqServiceServer
+
+	token string
+	lis   *bufconn.Listener
+	grpc  *grpc.Server
+
+	mu         sync.Mutex
+	messages   []*storedMessage
+	offset     time.Duration
+	faults     map[string][]codes.Code
+	changed    chan struct{} // closed when messages or the clock change
+	disconnect chan struct{} // closed to disconnect the running subscriptions
+	disconnErr error
+}
+
+// NewServer starts a server on an in-memory listener. Call Close to stop it.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		lis:        bufconn.Listen(listenerBufferSize),
+		grpc:       grpc.NewServer(),
+		faults:     make(map[string][]codes.Code),
+		changed:    make(chan struct{}),
+		disconnect: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mqv1.RegisterMqServiceServer(s.grpc, s)
+	go s.grpc.Serve(s.lis)
+	return s
+}
+
+// NewClient starts a server and returns it with a client connected to it.
+// Both are closed when the test ends.
+func NewClient(t testing.TB, opts ...togomq.ConfigOption) (*Server, *togomq.Client) {
+	t.Helper()
+
+	srv := NewServer()
+	client, err := srv.NewClient(opts...)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("togomqtest: failed to create client: %v", err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		srv.Close()
+	})
+	return srv, client
+}
+
+// NewClient returns a client connected to the server.
+// The options are applied after the ones that connect the client to the server.
+func (s *Server) NewClient(opts ...togomq.ConfigOption) (*togomq.Client, error) {
+	token := s.token
+	if token == "" {
+		token = DefaultToken
+	}
+
+	base := []togomq.ConfigOption{
+		togomq.WithHost("localhost"), // ignored by the dialer
+		togomq.WithToken(token),
+		togomq.WithUseTLS(false),
+		togomq.WithLogLevel("none"),
+		togomq.WithDialOptions(grpc.WithContextDialer(s.Dial)),
+	}
+	return togomq.NewClient(togomq.NewConfig(append(base, opts...)...))
+}
+
+// Dial opens a connection to the server, for use with grpc.WithContextDialer
+func (s *Server) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	return s.lis.DialContext(ctx)
+}
+
+// Close stops the server and closes all its streams
+func (s *Server) Close() {
+	s.grpc.Stop()
+}
+
+// FailNext makes the next times calls to method fail with code before doing anything.
+// Faults injected for the same method are consumed in order.
+func (s *Server) FailNext(method string, code codes.Code, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.faults[method] = append(s.faults[method], code)
+	}
+}
+
+// DisconnectSubscribers ends the running subscribe streams with code
+func (s *Server) DisconnectSubscribers(code codes.Code) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnErr = status.Error(code, "disconnected by test server")
+	close(s.disconnect)
+	s.disconnect = make(chan struct{})
+}
+
+// Advance moves the server clock forward, making postponed messages available
+// and expiring retained ones
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+	s.notify()
+}
+
+// Messages returns the stored messages matching the topic pattern that have not been
+// delivered or expired yet, including postponed ones
+func (s *Server) Messages(pattern string) []*togomq.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var messages []*togomq.Message
+	for _, m := range s.messages {
+		if !m.expired(now) && MatchTopic(pattern, m.topic) {
+			messages = append(messages, m.toMessage())
+		}
+	}
+	return messages
+}
+
+// PubMessage stores the published messages
+func (s *Server) PubMessage(stream mqv1.MqService_PubMessageServer) error {
+	if err := s.check(stream.Context(), MethodPubMessage); err != nil {
+		return err
+	}
+
+	var received int64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&mqv1.PubMessageResponse{MessagesReceived: received})
+		}
+		if err != nil {
+			return err
+		}
+		if req.Topic == "" {
+			return status.Error(codes.InvalidArgument, "message topic is required")
+		}
+
+		s.store(req)
+		received++
+	}
+}
+
+// SubMessage delivers the matching messages until the stream is cancelled
+func (s *Server) SubMessage(req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+	if err := s.check(stream.Context(), MethodSubMessage); err != nil {
+		return err
+	}
+	if req.Topic == "" {
+		return status.Error(codes.InvalidArgument, "topic is required")
+	}
+
+	for {
+		messages, wake, changed, disconnect := s.claim(req.Topic)
+
+		for i, m := range messages {
+			if err := stream.Send(m.toResponse()); err != nil {
+				s.unclaim(messages[i:])
+				return err
+			}
+			if req.SpeedPerSec > 0 {
+				time.Sleep(time.Second / time.Duration(req.SpeedPerSec))
+			}
+		}
+
+		if err := s.wait(stream.Context(), wake, changed, disconnect); err != nil {
+			return err
+		}
+		if stream.Context().Err() != nil {
+			return nil
+		}
+	}
+}
+
+// wait blocks until ctx is done, a change is signalled or the wake delay elapses (0 = no delay).
+// It returns the disconnection error when the subscriptions are disconnected.
+func (s *Server) wait(ctx context.Context, wake time.Duration, changed, disconnect <-chan struct{}) error {
+	var timer <-chan time.Time
+	if wake > 0 {
+		t := time.NewTimer(wake)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-changed:
+	case <-timer:
+	case <-disconnect:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.disconnErr
+	}
+	return nil
+}
+
+// CountMessages counts the stored messages matching the topic pattern
+func (s *Server) CountMessages(ctx context.Context, req *mqv1.CountMessagesRequest) (*mqv1.CountMessagesResponse, error) {
+	if err := s.check(ctx, MethodCountMessages); err != nil {
+		return nil, err
+	}
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "topic is required")
+	}
+	return &mqv1.CountMessagesResponse{MessagesCount: int64(len(s.Messages(req.Topic)))}, nil
+}
+
+// MatchTopic reports whether topic matches the pattern, see togomq.MatchTopic
+func MatchTopic(pattern, topic string) bool {
+	return togomq.MatchTopic(pattern, topic)
+}
+
+// check consumes an injected fault for the method and verifies the token
+func (s *Server) check(ctx context.Context, method string) error {
+	s.mu.Lock()
+	if faults := s.faults[method]; len(faults) > 0 {
+		s.faults[method] = faults[1:]
+		s.mu.Unlock()
+		return status.Errorf(faults[0], "fault injected by test server")
+	}
+	s.mu.Unlock()
+
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tokens := md.Get("authorization"); len(tokens) == 0 || tokens[0] != s.token {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
+
+// store adds a published message
+func (s *Server) store(req *mqv1.PubMessageRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	m := &storedMessage{
+		uuid:        newUUID(),
+		topic:       req.Topic,
+		body:        req.Body,
+		variables:   req.Variables,
+		availableAt: now.Add(time.Duration(req.Postpone) * time.Second),
+	}
+	if req.Retention > 0 {
+		m.expiresAt = now.Add(time.Duration(req.Retention) * time.Second)
+	}
+	s.messages = append(s.messages, m)
+	s.notify()
+}
+
+// claim removes and returns the available messages matching the pattern. It also returns
+// the delay until the next postponed message becomes available (0 = none) and the channels
+// that signal a change and a disconnection.
+func (s *Server) claim(pattern string) ([]*storedMessage, time.Duration, <-chan struct{}, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var claimed []*storedMessage
+	var wake time.Duration
+	kept := s.messages[:0]
+	for _, m := range s.messages {
+		switch {
+		case m.expired(now):
+			// Dropped
+		case !MatchTopic(pattern, m.topic):
+			kept = append(kept, m)
+		case m.availableAt.After(now):
+			if d := m.availableAt.Sub(now); wake == 0 || d < wake {
+				wake = d
+			}
+			kept = append(kept, m)
+		default:
+			claimed = append(claimed, m)
+		}
+	}
+	s.messages = kept
+	return claimed, wake, s.changed, s.disconnect
+}
+
+// unclaim puts back messages that could not be delivered
+func (s *Server) unclaim(messages []*storedMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(append([]*storedMessage{}, messages...), s.messages...)
+	s.notify()
+}
+
+// notify wakes up the subscriptions waiting for a change, s.mu must be held
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// now returns the server clock, s.mu must be held
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// expired reports whether the retention of the message has elapsed
+func (m *storedMessage) expired(now time.Time) bool {
+	return !m.expiresAt.IsZero() && !now.Before(m.expiresAt)
+}
+
+// toResponse converts the message to a SubMessageResponse
+func (m *storedMessage) toResponse() *mqv1.SubMessageResponse {
+	return &mqv1.SubMessageResponse{
+		Topic:     m.topic,
+		Uuid:      m.uuid,
+		Body:      m.body,
+		Variables: m.variables,
+	}
+}
+
+// toMessage converts the message to a togomq.Message
+func (m *storedMessage) toMessage() *togomq.Message {
+	return &togomq.Message{
+		Topic:     m.topic,
+		UUID:      m.uuid,
+		Body:      m.body,
+		Variables: m.variables,
+	}
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,217 @@
+package togomqtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	togomq "github.com/TogoMQ/togomq-sdk-go"
+	"google.golang.org/grpc/codes"
+)
+
+// receive returns the next message, or nil if none arrives within wait
+func receive(t *testing.T, msgChan <-chan *togomq.Message, errChan <-chan error, wait time.Duration) *togomq.Message {
+	t.Helper()
+	select {
+	case msg := <-msgChan:
+		return msg
+	case err := <-errChan:
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(wait):
+	}
+	return nil
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders.created", false},
+		{"*", "orders.created", true},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.eu.created", true},
+		{"orders.*", "orders", false},
+		{"orders.*", "events.created", false},
+		{"*.created", "orders.created", true},
+		{"*.created", "orders.deleted", false},
+		{"orders.*.created", "orders.eu.created", true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestServer_PubSub(t *testing.T) {
+	srv, client := NewClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := client.PubBatch(ctx, []*togomq.Message{
+		togomq.NewMessage("orders.created", []byte("order")).WithVariables(map[string]string{"id": "1"}),
+		togomq.NewMessage("events.created", []byte("event")),
+	})
+	if err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if resp.MessagesReceived != 2 {
+		t.Errorf("Expected 2 messages received, got %d", resp.MessagesReceived)
+	}
+
+	msgChan, errChan, err := client.Sub(ctx, togomq.NewSubscribeOptions("orders.*"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	msg := receive(t, msgChan, errChan, time.Second)
+	if msg == nil || msg.Topic != "orders.created" || string(msg.Body) != "order" || msg.Variables["id"] != "1" {
+		t.Fatalf("Expected orders.created message, got %+v", msg)
+	}
+	if msg.UUID == "" {
+		t.Error("Expected message UUID")
+	}
+
+	// Messages published after the subscription started are delivered too
+	if _, err := client.PubBatch(ctx, []*togomq.Message{togomq.NewMessage("orders.deleted", []byte("x"))}); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if msg := receive(t, msgChan, errChan, time.Second); msg == nil || msg.Topic != "orders.deleted" {
+		t.Fatalf("Expected orders.deleted message, got %+v", msg)
+	}
+
+	if remaining := srv.Messages("*"); len(remaining) != 1 || remaining[0].Topic != "events.created" {
+		t.Errorf("Expected only events.created to remain, got %+v", remaining)
+	}
+}
+
+func TestServer_Postpone(t *testing.T) {
+	srv, client := NewClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg := togomq.NewMessage("orders", []byte("later")).WithPostpone(60)
+	if _, err := client.PubBatch(ctx, []*togomq.Message{msg}); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	msgChan, errChan, err := client.Sub(ctx, togomq.NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if msg := receive(t, msgChan, errChan, 50*time.Millisecond); msg != nil {
+		t.Fatalf("Expected postponed message to be held, got %+v", msg)
+	}
+
+	srv.Advance(time.Minute)
+	if msg := receive(t, msgChan, errChan, time.Second); msg == nil || string(msg.Body) != "later" {
+		t.Fatalf("Expected postponed message after advancing the clock, got %+v", msg)
+	}
+}
+
+func TestServer_Retention(t *testing.T) {
+	srv, client := NewClient(t)
+	ctx := context.Background()
+
+	messages := []*togomq.Message{
+		togomq.NewMessage("orders", []byte("short")).WithRetention(10),
+		togomq.NewMessage("orders", []byte("long")).WithRetention(3600),
+	}
+	if _, err := client.PubBatch(ctx, messages); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	srv.Advance(11 * time.Second)
+
+	count, err := client.CountMessages(ctx, "orders")
+	if err != nil {
+		t.Fatalf("CountMessages failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 message after retention expired, got %d", count)
+	}
+}
+
+func TestServer_FailNext(t *testing.T) {
+	srv, client := NewClient(t)
+	ctx := context.Background()
+
+	srv.FailNext(MethodCountMessages, codes.Unavailable, 1)
+
+	_, err := client.CountMessages(ctx, "orders")
+	var tmqErr *togomq.TogoMQError
+	if !errors.As(err, &tmqErr) || tmqErr.Code != togomq.ErrCodeConnection {
+		t.Fatalf("Expected connection error, got %v", err)
+	}
+
+	if _, err := client.CountMessages(ctx, "orders"); err != nil {
+		t.Errorf("Expected the fault to be consumed, got %v", err)
+	}
+}
+
+func TestServer_FailNextWithRetry(t *testing.T) {
+	policy := togomq.DefaultRetryPolicy().WithBackoff(togomq.Backoff{InitialDelay: time.Millisecond})
+	srv, client := NewClient(t, togomq.WithRetryPolicy(policy))
+
+	srv.FailNext(MethodPubMessage, codes.Unavailable, 2)
+
+	resp, err := client.PubBatch(context.Background(), []*togomq.Message{togomq.NewMessage("orders", []byte("x"))})
+	if err != nil {
+		t.Fatalf("Expected PubBatch to succeed after retries, got %v", err)
+	}
+	if resp.MessagesReceived != 1 {
+		t.Errorf("Expected 1 message received, got %d", resp.MessagesReceived)
+	}
+}
+
+func TestServer_Token(t *testing.T) {
+	srv := NewServer(WithToken("secret"))
+	defer srv.Close()
+
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.CountMessages(context.Background(), "orders"); err != nil {
+		t.Errorf("Expected the server token to be accepted, got %v", err)
+	}
+
+	wrong, err := srv.NewClient(togomq.WithToken("wrong"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer wrong.Close()
+
+	_, err = wrong.CountMessages(context.Background(), "orders")
+	var tmqErr *togomq.TogoMQError
+	if !errors.As(err, &tmqErr) || tmqErr.Code != togomq.ErrCodeAuth {
+		t.Errorf("Expected auth error, got %v", err)
+	}
+}
+
+func TestServer_DisconnectSubscribers(t *testing.T) {
+	srv, client := NewClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reconnect := togomq.NewReconnectOptions().WithBackoff(togomq.Backoff{InitialDelay: time.Millisecond})
+	msgChan, errChan, err := client.Sub(ctx, togomq.NewSubscribeOptions("orders").WithReconnect(reconnect))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	srv.DisconnectSubscribers(codes.Unavailable)
+
+	if _, err := client.PubBatch(ctx, []*togomq.Message{togomq.NewMessage("orders", []byte("x"))}); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+	if msg := receive(t, msgChan, errChan, 2*time.Second); msg == nil {
+		t.Fatal("Expected message after reconnecting")
+	}
+}
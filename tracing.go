@@ -0,0 +1,129 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation name of the spans created by the SDK
+const tracerName = "github.com/TogoMQ/togomq-sdk-go"
+
+// Span names and attribute keys of the spans created by the SDK
+const (
+	spanPublish = "togomq.publish"
+	spanReceive = "togomq.receive"
+
+	attrMessagingSystem       = "messaging.system"
+	attrMessagingOperation    = "messaging.operation.type"
+	attrMessagingDestination  = "messaging.destination.name"
+	attrMessagingMessageID    = "messaging.message.id"
+	attrMessagingMessageCount = "messaging.batch.message_count"
+	attrMessagingBodySize     = "messaging.message.body.size"
+	attrTogoMQOperation       = "togomq.operation"
+	messagingSystemTogoMQ     = "togomq"
+)
+
+// tracingEnabled reports whether a tracer provider is configured
+func (c *Client) tracingEnabled() bool {
+	return c.config.TracerProvider != nil
+}
+
+// tracer returns the SDK tracer, or a no-op tracer when tracing is disabled
+func (c *Client) tracer() trace.Tracer {
+	if !c.tracingEnabled() {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return c.config.TracerProvider.Tracer(tracerName)
+}
+
+// propagator returns the configured propagator, W3C trace context by default
+func (c *Client) propagator() propagation.TextMapPropagator {
+	if c.config.Propagator != nil {
+		return c.config.Propagator
+	}
+	return propagation.TraceContext{}
+}
+
+// startPublishSpan starts the span covering a publish stream
+func (c *Client) startPublishSpan(ctx context.Context) (context.Context, trace.Span) {
+	return c.tracer().Start(ctx, spanPublish,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String(attrMessagingSystem, messagingSystemTogoMQ),
+			attribute.String(attrMessagingOperation, "publish"),
+			attribute.String(attrTogoMQOperation, operation(ctx)),
+		),
+	)
+}
+
+// endPublishSpan records the outcome of a publish stream and ends its span
+func endPublishSpan(span trace.Span, resp *PubResponse, err error) {
+	if resp != nil {
+		span.SetAttributes(attribute.Int(attrMessagingMessageCount, resp.MessagesSent))
+	}
+	endSpan(span, err)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracePublish is the built-in publish middleware that injects the trace context
+// of the publish span into the message variables
+func (c *Client) tracePublish(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		// The message of the caller is left untouched, it may be retried with another span
+		traced := *msg
+		traced.Variables = make(map[string]string, len(msg.Variables)+2)
+		for k, v := range msg.Variables {
+			traced.Variables[k] = v
+		}
+		c.propagator().Inject(ctx, propagation.MapCarrier(traced.Variables))
+		return next.Handle(ctx, &traced)
+	})
+}
+
+// traceConsume is the built-in consume middleware that creates a span for every
+// received message, linked to the producer span found in the message variables.
+// The span ends once the message is handed to the message channel or prefetch buffer, so it
+// measures the receipt and delivery of the message, not its processing by the consumer.
+func (c *Client) traceConsume(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, msg *Message) error {
+		var opts []trace.SpanStartOption
+		producer := trace.SpanContextFromContext(
+			c.propagator().Extract(context.Background(), propagation.MapCarrier(msg.Variables)))
+		if producer.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+		}
+		opts = append(opts,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String(attrMessagingSystem, messagingSystemTogoMQ),
+				attribute.String(attrMessagingOperation, "receive"),
+				attribute.String(attrMessagingDestination, msg.Topic),
+				attribute.String(attrMessagingMessageID, msg.UUID),
+				attribute.Int(attrMessagingBodySize, len(msg.Body)),
+			),
+		)
+
+		ctx, span := c.tracer().Start(ctx, spanReceive, opts...)
+		err := next.Handle(ctx, msg)
+		if errors.Is(err, ErrSkipMessage) {
+			endSpan(span, nil)
+		} else {
+			endSpan(span, err)
+		}
+		return err
+	})
+}
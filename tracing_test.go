@@ -0,0 +1,201 @@
+package togomq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	mqv1 "github.com/TogoMQ/togomq-grpc-go/mq/v1"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTracingClient returns a test client that records its spans in the returned exporter
+func newTracingClient(t *testing.T, srv mqv1.MqServiceServer) (*Client, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	client := newTestClient(t, srv)
+	client.config.TracerProvider = provider
+	return client, exporter
+}
+
+// spanAttr returns the value of an attribute of a recorded span
+func spanAttr(span tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing_PubBatchInjectsTraceContext(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client, exporter := newTracingClient(t, recordingPubServer(&mu, &received))
+
+	messages := []*Message{
+		NewMessage("orders", []byte("a")),
+		NewMessage("orders", []byte("b")).WithVariables(map[string]string{"k": "v"}),
+	}
+	if _, err := client.PubBatch(context.Background(), messages); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != spanPublish || span.SpanKind != trace.SpanKindProducer {
+		t.Errorf("Expected producer span %s, got %s (%v)", spanPublish, span.Name, span.SpanKind)
+	}
+	if v, ok := spanAttr(span, attrMessagingMessageCount); !ok || v.AsInt64() != 2 {
+		t.Errorf("Expected message count 2, got %v", v.Emit())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(received))
+	}
+	for _, req := range received {
+		traceparent := req.Variables["traceparent"]
+		if traceparent == "" {
+			t.Fatalf("Expected traceparent variable, got %v", req.Variables)
+		}
+		expected := "00-" + span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String() + "-01"
+		if traceparent != expected {
+			t.Errorf("Expected traceparent %s, got %s", expected, traceparent)
+		}
+	}
+	if received[1].Variables["k"] != "v" {
+		t.Errorf("Expected user variables to be kept, got %v", received[1].Variables)
+	}
+	if len(messages[0].Variables) != 0 || len(messages[1].Variables) != 1 {
+		t.Errorf("Expected the messages of the caller to be unchanged, got %v and %v", messages[0].Variables, messages[1].Variables)
+	}
+}
+
+func TestTracing_WrappedSkipIsNotAnError(t *testing.T) {
+	client, exporter := newTracingClient(t, &fakeServer{})
+
+	skip := HandlerFunc(func(ctx context.Context, msg *Message) error {
+		return fmt.Errorf("duplicate: %w", ErrSkipMessage)
+	})
+	if err := client.traceConsume(skip).Handle(context.Background(), NewMessage("orders", nil)); !errors.Is(err, ErrSkipMessage) {
+		t.Fatalf("Expected the skip to be returned, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Status.Code == otelcodes.Error {
+		t.Errorf("Expected a span without error, got %v", spans)
+	}
+}
+
+func TestTracing_PubBatchRecordsError(t *testing.T) {
+	srv := &fakeServer{
+		pubFunc: func(call int, stream mqv1.MqService_PubMessageServer) error {
+			return status.Error(codes.Unavailable, "down")
+		},
+	}
+	client, exporter := newTracingClient(t, srv)
+
+	_, err := client.PubBatch(context.Background(), []*Message{NewMessage("orders", []byte("a"))})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status.Code != otelcodes.Error {
+		t.Errorf("Expected error status, got %v", spans[0].Status)
+	}
+}
+
+func TestTracing_SubLinksProducerSpan(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	srv := &fakeServer{
+		subFunc: func(call int, req *mqv1.SubMessageRequest, stream mqv1.MqService_SubMessageServer) error {
+			if err := stream.Send(&mqv1.SubMessageResponse{
+				Topic:     "orders",
+				Uuid:      "1",
+				Body:      []byte("payload"),
+				Variables: map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-01"},
+			}); err != nil {
+				return err
+			}
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	client, exporter := newTracingClient(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgChan, _, err := client.Sub(ctx, NewSubscribeOptions("orders"))
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if msg := <-msgChan; msg == nil || msg.UUID != "1" {
+		t.Fatalf("Expected message 1, got %+v", msg)
+	}
+
+	// The receive span ends once the message is delivered
+	var spans tracetest.SpanStubs
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if spans = exporter.GetSpans(); len(spans) > 0 {
+			break
+		}
+	}
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != spanReceive || span.SpanKind != trace.SpanKindConsumer {
+		t.Errorf("Expected consumer span %s, got %s (%v)", spanReceive, span.Name, span.SpanKind)
+	}
+	if len(span.Links) != 1 {
+		t.Fatalf("Expected 1 link, got %d", len(span.Links))
+	}
+	link := span.Links[0].SpanContext
+	if link.TraceID().String() != traceID || link.SpanID().String() != spanID {
+		t.Errorf("Expected link to %s/%s, got %s/%s", traceID, spanID, link.TraceID(), link.SpanID())
+	}
+	if v, ok := spanAttr(span, attrMessagingMessageID); !ok || v.AsString() != "1" {
+		t.Errorf("Expected message id 1, got %v", v.Emit())
+	}
+}
+
+func TestTracing_DisabledLeavesVariables(t *testing.T) {
+	var mu sync.Mutex
+	var received []*mqv1.PubMessageRequest
+	client := newTestClient(t, recordingPubServer(&mu, &received))
+
+	if _, err := client.PubBatch(context.Background(), []*Message{NewMessage("orders", []byte("a"))}); err != nil {
+		t.Fatalf("PubBatch failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || len(received[0].Variables) != 0 {
+		t.Errorf("Expected no variables without a tracer provider, got %+v", received)
+	}
+}